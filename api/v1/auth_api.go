@@ -10,9 +10,15 @@ import (
 	"golang.org/x/oauth2"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
+// authTimeout bounds a token request, which holds the lock of the client
+const authTimeout = 10 * time.Second
+
+var authClient = &http.Client{Timeout: authTimeout}
+
 type AuthData struct {
 	ClientName   string `json:"clientName"`
 	ClientSecret string `json:"clientSecret"`
@@ -28,6 +34,12 @@ type GraphQLClient struct {
 	client    *graphql.Client
 	TokenData *TokenData
 	authData  *AuthData
+	// hostId selects the redirects of the host on the Central API
+	hostId string
+	// authErr is the error of the latest token request, it is cleared once a token was obtained
+	authErr error
+	// mu guards the token and the client, which are refreshed by the syncs, the logger and the readiness checks
+	mu sync.Mutex
 }
 
 func NewAuthData(clientName string, clientSecret string, serverURL string, jwtSecret string) *AuthData {
@@ -43,32 +55,69 @@ func NewTokenData() *TokenData {
 	return &TokenData{}
 }
 
-func NewGraphQLClient(authData *AuthData) *GraphQLClient {
+func NewGraphQLClient(authData *AuthData, hostId string) *GraphQLClient {
 	return &GraphQLClient{
 		TokenData: NewTokenData(),
 		authData:  authData,
+		hostId:    hostId,
 	}
 }
 
 // GetClient makes sure the access token is refreshed
 func (gql *GraphQLClient) GetClient() *graphql.Client {
+	if _, err := gql.AccessToken(); err != nil {
+		log.Println("Failed to get token:", err)
+		return nil
+	}
+
+	gql.mu.Lock()
+	defer gql.mu.Unlock()
+
+	return gql.client
+}
+
+// AccessToken returns a valid access token, requesting a new one when it is missing or expired
+func (gql *GraphQLClient) AccessToken() (string, error) {
+	gql.mu.Lock()
+	defer gql.mu.Unlock()
+
 	if gql.TokenData.Token == "" || gql.isTokenExpired(gql.TokenData.Token) {
 		err := gql.getNewAccessToken()
 		if err != nil {
-			log.Println("Failed to get token:", err)
-			return nil
+			return "", err
 		}
 	}
 
-	return gql.client
+	return gql.TokenData.Token, nil
+}
+
+// CheckCachedToken tells whether the access token obtained last is still valid, without requesting a new one
+func (gql *GraphQLClient) CheckCachedToken() error {
+	gql.mu.Lock()
+	token, authErr := gql.TokenData.Token, gql.authErr
+	gql.mu.Unlock()
+
+	switch {
+	case authErr != nil:
+		return fmt.Errorf("the latest token request failed: %v", authErr)
+	case token == "":
+		return fmt.Errorf("no access token was obtained yet")
+	case gql.isTokenExpired(token):
+		return fmt.Errorf("the access token expired")
+	}
+
+	return nil
 }
 
 func (gql *GraphQLClient) getNewAccessToken() error {
 	token, err := gql.auth()
+	gql.authErr = err
 	if err != nil {
+		authErrors.Inc()
 		log.Println("Authentication failed:", err)
 		return err
 	}
+	tokenRefreshes.Inc()
 	gql.updateGraphQLClient(token)
 	gql.TokenData.Token = token
 
@@ -88,7 +137,7 @@ func (gql *GraphQLClient) auth() (string, error) {
 	}
 
 	authEndpoint := fmt.Sprintf("%s/auth", gql.authData.ServerURL)
-	res, err := http.Post(authEndpoint, "application/json", bytes.NewReader(marshalled))
+	res, err := authClient.Post(authEndpoint, "application/json", bytes.NewReader(marshalled))
 	if err != nil {
 		return "", fmt.Errorf("error while authenticating: %v", err)
 	}
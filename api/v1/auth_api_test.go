@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGraphQLClient_CheckCachedToken(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"exp": expiresAt.Unix(),
+		}).SignedString([]byte(testJwtSecret))
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token})
+	}))
+	defer server.Close()
+
+	gql := NewGraphQLClient(NewAuthData("client", "secret", server.URL, testJwtSecret), "host-1")
+	if err := gql.CheckCachedToken(); err == nil {
+		t.Errorf("expected an error before a token was obtained")
+	}
+
+	if _, err := gql.AccessToken(); err != nil {
+		t.Fatalf("Failed to get a token: %v", err)
+	}
+	if err := gql.CheckCachedToken(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// An expired token is reported without requesting a new one
+	expiresAt = time.Now().Add(-time.Hour)
+	gql.TokenData.Token, _ = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"exp": expiresAt.Unix(),
+	}).SignedString([]byte(testJwtSecret))
+	if err := gql.CheckCachedToken(); err == nil {
+		t.Errorf("expected an error for an expired token")
+	}
+
+	status = http.StatusUnauthorized
+	if _, err := gql.AccessToken(); err == nil {
+		t.Fatalf("expected the token request to fail")
+	}
+	if err := gql.CheckCachedToken(); err == nil {
+		t.Errorf("expected the failed token request to be reported")
+	}
+}
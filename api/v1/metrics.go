@@ -0,0 +1,14 @@
+package v1
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/metrics"
+)
+
+var (
+	graphqlErrors = metrics.NewCounter("redirects_graphql_errors_total",
+		"Failed requests to the GraphQL API of Central, by operation.", "operation")
+	authErrors = metrics.NewCounter("redirects_auth_errors_total",
+		"Failed authentications with the Central API.")
+	tokenRefreshes = metrics.NewCounter("redirects_token_refreshes_total",
+		"Access tokens obtained from the Central API, because the previous one was missing or expired.")
+)
@@ -5,16 +5,37 @@ import (
 	"fmt"
 	"github.com/shurcooL/graphql"
 	"log"
-	"os"
 	"time"
 )
 
 type Redirect struct {
+	Id         string
+	FromURL    string
+	FromDomain string
+	ToURL      string
+	UpdatedAt  time.Time
+	// StatusCode of the redirect, 0 for the default 302
+	StatusCode int
+}
+
+// RedirectNode is a redirect as queried from the Central API
+type RedirectNode struct {
 	Id         string    `graphql:"id"`
 	FromURL    string    `graphql:"fromURL"`
 	FromDomain string    `graphql:"fromDomain"`
 	ToURL      string    `graphql:"toURL"`
 	UpdatedAt  time.Time `graphql:"updatedAt"`
+	StatusCode int       `graphql:"statusCode"`
+}
+
+func (n RedirectNode) Redirect() Redirect {
+	return Redirect{Id: n.Id, FromURL: n.FromURL, FromDomain: n.FromDomain, ToURL: n.ToURL, UpdatedAt: n.UpdatedAt, StatusCode: n.StatusCode}
+}
+
+// Tombstone marks a redirect that was deleted on the Central API
+type Tombstone struct {
+	Id        string    `graphql:"id"`
+	DeletedAt time.Time `graphql:"deletedAt"`
 }
 
 type PageInfo struct {
@@ -23,58 +44,85 @@ type PageInfo struct {
 }
 
 type RedirectEdge struct {
-	Node   Redirect
+	Node   RedirectNode
 	Cursor string
 }
 
-type RedirectConnection struct {
-	Edges    []RedirectEdge
-	PageInfo PageInfo
+type RedirectChangesConnection struct {
+	Edges      []RedirectEdge
+	Tombstones []Tombstone
+	PageInfo   PageInfo
+	Watermark  string
 }
 
-func (gql *GraphQLClient) ExecuteRedirectsQuery() ([]Redirect, error) {
-	var allRedirects []Redirect
+// RedirectChanges holds everything that changed on the Central API since a watermark.
+// A Full result is a snapshot of all redirects, so anything missing from it was deleted.
+type RedirectChanges struct {
+	// Source names the rule source the changes come from, it is set by the receiving side
+	Source     string
+	Redirects  []Redirect
+	Tombstones []Tombstone
+	Watermark  string
+	Full       bool
+	// Pushed changes come from the subscription, they don't move the watermark since changes may have been missed before them
+	Pushed bool
+}
+
+/*
+ExecuteRedirectChangesQuery fetches the redirects changed since the given server-issued watermark,
+including the deleted ones as tombstones. An empty watermark returns a full snapshot.
+The returned watermark should be passed to the next call.
+*/
+func (gql *GraphQLClient) ExecuteRedirectChangesQuery(since string) (RedirectChanges, error) {
+	changes := RedirectChanges{Full: since == ""}
 	var endCursor string
 	for {
-		redirects, pageInfo, err := gql.fetchRedirectsPage(endCursor)
+		page, err := gql.fetchRedirectChangesPage(since, endCursor)
 		if err != nil {
-			return nil, err
+			return RedirectChanges{}, err
+		}
+		for _, edge := range page.Edges {
+			changes.Redirects = append(changes.Redirects, edge.Node.Redirect())
 		}
-		allRedirects = append(allRedirects, redirects...)
-		if !pageInfo.HasNextPage {
+		changes.Tombstones = append(changes.Tombstones, page.Tombstones...)
+		changes.Watermark = page.Watermark
+		if !page.PageInfo.HasNextPage {
 			break
 		}
-		endCursor = pageInfo.EndCursor
+		endCursor = page.PageInfo.EndCursor
 		time.Sleep(100 * time.Millisecond)
 	}
-	return allRedirects, nil
+	return changes, nil
 }
 
-func (gql *GraphQLClient) fetchRedirectsPage(cursor string) ([]Redirect, PageInfo, error) {
+func (gql *GraphQLClient) fetchRedirectChangesPage(since, cursor string) (RedirectChangesConnection, error) {
 	var query struct {
-		Redirects RedirectConnection `graphql:"redirects(hostId: $hostId, first: 100, after: $cursor)"`
+		RedirectChanges RedirectChangesConnection `graphql:"redirectChanges(hostId: $hostId, since: $since, first: 100, after: $cursor)"`
+	}
+
+	// A null watermark asks the server for a full snapshot
+	var sinceVar *graphql.String
+	if since != "" {
+		sinceVar = graphql.NewString(graphql.String(since))
 	}
 
 	vars := map[string]interface{}{
-		"hostId": graphql.String(os.Getenv("HOST_ID")),
+		"hostId": graphql.String(gql.hostId),
+		"since":  sinceVar,
 		"cursor": graphql.String(cursor),
 	}
 
 	client := gql.GetClient()
 	if client == nil {
-		return nil, PageInfo{}, fmt.Errorf("GraphQL client not initialized")
+		return RedirectChangesConnection{}, fmt.Errorf("GraphQL client not initialized")
 	}
 
 	err := client.Query(context.Background(), &query, vars)
 	if err != nil {
+		graphqlErrors.Inc("redirectChanges")
 		log.Println("GraphQL server not reachable!", err)
-		return nil, PageInfo{}, err
-	}
-
-	var redirects []Redirect
-	for _, edge := range query.Redirects.Edges {
-		redirects = append(redirects, edge.Node)
+		return RedirectChangesConnection{}, err
 	}
 
-	return redirects, query.Redirects.PageInfo, nil
+	return query.RedirectChanges, nil
 }
@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// graphql-ws protocol, see https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	graphqlWSProtocol = "graphql-transport-ws"
+	subscriptionId    = "redirects"
+	ackTimeout        = 10 * time.Second
+)
+
+const redirectsChangedSubscription = `subscription($hostId: String!) {
+	redirectsChanged(hostId: $hostId) {
+		redirect { id fromURL fromDomain toURL updatedAt statusCode }
+		deleted
+	}
+}`
+
+type wsMessage struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// RedirectChangedEvent is a single change pushed by the redirectsChanged subscription
+type RedirectChangedEvent struct {
+	Redirect Redirect `json:"redirect"`
+	Deleted  bool     `json:"deleted"`
+}
+
+/*
+SubscribeRedirectsChanged subscribes to the redirectsChanged subscription over graphql-ws
+and sends every change to the channel as an incremental RedirectChanges, marked as Pushed.
+onConnected is called once the subscription is active. It blocks until the connection drops or the context is done.
+*/
+func (gql *GraphQLClient) SubscribeRedirectsChanged(ctx context.Context, onConnected func(), changesCh chan<- RedirectChanges) error {
+	token, err := gql.AccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get token: %v", err)
+	}
+
+	dialer := websocket.Dialer{
+		Subprotocols:     []string{graphqlWSProtocol},
+		HandshakeTimeout: ackTimeout,
+	}
+	header := http.Header{"Authorization": []string{"Bearer " + token}}
+
+	conn, _, err := dialer.DialContext(ctx, gql.subscriptionURL(), header)
+	if err != nil {
+		return fmt.Errorf("error while connecting to the subscription endpoint: %v", err)
+	}
+
+	// Unblock the read loop once the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+			_ = conn.Close()
+		}
+	}()
+
+	if err := gql.initSubscription(conn, token); err != nil {
+		return err
+	}
+	onConnected()
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("subscription connection lost: %v", err)
+		}
+
+		switch msg.Type {
+		case "next":
+			var payload struct {
+				Data struct {
+					RedirectsChanged RedirectChangedEvent `json:"redirectsChanged"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				return fmt.Errorf("failed to decode subscription payload: %v", err)
+			}
+			changesCh <- payload.Data.RedirectsChanged.toRedirectChanges()
+		case "ping":
+			if err := conn.WriteJSON(wsMessage{Type: "pong"}); err != nil {
+				return fmt.Errorf("failed to answer ping: %v", err)
+			}
+		case "error":
+			graphqlErrors.Inc("redirectsChanged")
+			return fmt.Errorf("subscription error: %s", msg.Payload)
+		case "complete":
+			return fmt.Errorf("subscription completed by the server")
+		}
+	}
+}
+
+// initSubscription performs the graphql-ws handshake and starts the redirectsChanged subscription
+func (gql *GraphQLClient) initSubscription(conn *websocket.Conn, token string) error {
+	initPayload, _ := json.Marshal(map[string]string{"Authorization": "Bearer " + token})
+	if err := conn.WriteJSON(wsMessage{Type: "connection_init", Payload: initPayload}); err != nil {
+		return fmt.Errorf("failed to initialize the subscription connection: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	var ack wsMessage
+	if err := conn.ReadJSON(&ack); err != nil || ack.Type != "connection_ack" {
+		return fmt.Errorf("subscription connection not acknowledged: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	subscribePayload, err := json.Marshal(map[string]interface{}{
+		"query":     redirectsChangedSubscription,
+		"variables": map[string]string{"hostId": gql.hostId},
+	})
+	if err != nil {
+		return fmt.Errorf("error while building the subscription: %v", err)
+	}
+
+	if err := conn.WriteJSON(wsMessage{Id: subscriptionId, Type: "subscribe", Payload: subscribePayload}); err != nil {
+		return fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	return nil
+}
+
+// subscriptionURL turns the http(s) server URL into the ws(s) GraphQL endpoint
+func (gql *GraphQLClient) subscriptionURL() string {
+	serverURL := gql.authData.ServerURL
+	if strings.HasPrefix(serverURL, "https://") {
+		serverURL = "wss://" + strings.TrimPrefix(serverURL, "https://")
+	} else {
+		serverURL = "ws://" + strings.TrimPrefix(serverURL, "http://")
+	}
+
+	return serverURL + "/graphql"
+}
+
+func (e RedirectChangedEvent) toRedirectChanges() RedirectChanges {
+	changes := RedirectChanges{Pushed: true}
+	if e.Deleted {
+		changes.Tombstones = []Tombstone{{Id: e.Redirect.Id, DeletedAt: e.Redirect.UpdatedAt}}
+	} else {
+		changes.Redirects = []Redirect{e.Redirect}
+	}
+
+	return changes
+}
@@ -0,0 +1,123 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testJwtSecret = "jwt-secret"
+
+// startMockSubscriptionServer stands in for the Central API auth and graphql-ws endpoints
+func startMockSubscriptionServer(t *testing.T, events []RedirectChangedEvent) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{graphqlWSProtocol}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth", func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte(testJwtSecret))
+		if err != nil {
+			t.Errorf("Failed to sign token: %v", err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token})
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "connection_init" {
+			t.Errorf("expected connection_init: got %v (%v)", msg.Type, err)
+			return
+		}
+		_ = conn.WriteJSON(wsMessage{Type: "connection_ack"})
+
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "subscribe" {
+			t.Errorf("expected subscribe: got %v (%v)", msg.Type, err)
+			return
+		}
+		var subscription struct {
+			Variables map[string]string `json:"variables"`
+		}
+		if err := json.Unmarshal(msg.Payload, &subscription); err != nil || subscription.Variables["hostId"] != "host-1" {
+			t.Errorf("unexpected subscription variables: %+v (%v)", subscription.Variables, err)
+		}
+
+		_ = conn.WriteJSON(wsMessage{Type: "ping"})
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "pong" {
+			t.Errorf("expected pong: got %v (%v)", msg.Type, err)
+			return
+		}
+
+		for _, event := range events {
+			payload, _ := json.Marshal(map[string]interface{}{
+				"data": map[string]interface{}{"redirectsChanged": event},
+			})
+			_ = conn.WriteJSON(wsMessage{Id: subscriptionId, Type: "next", Payload: payload})
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestGraphQLClient_SubscribeRedirectsChanged(t *testing.T) {
+	events := []RedirectChangedEvent{
+		{
+			Redirect: Redirect{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items", StatusCode: 301},
+		},
+		{
+			Redirect: Redirect{Id: "2"},
+			Deleted:  true,
+		},
+	}
+
+	server := startMockSubscriptionServer(t, events)
+	defer server.Close()
+
+	gql := NewGraphQLClient(NewAuthData("client", "secret", server.URL, testJwtSecret), "host-1")
+	changesCh := make(chan RedirectChanges, len(events))
+	connected := false
+
+	err := gql.SubscribeRedirectsChanged(context.Background(), func() { connected = true }, changesCh)
+	if err == nil {
+		t.Errorf("expected an error once the server closed the connection")
+	}
+	if !connected {
+		t.Errorf("onConnected was not called")
+	}
+
+	if len(changesCh) != len(events) {
+		t.Fatalf("unexpected number of changes: got %v want %v", len(changesCh), len(events))
+	}
+
+	updated := <-changesCh
+	if len(updated.Redirects) != 1 || updated.Redirects[0].ToURL != "/school/items" || updated.Redirects[0].StatusCode != 301 {
+		t.Errorf("unexpected update: %+v", updated)
+	}
+	// Pushed changes don't carry a watermark to resume from
+	if !updated.Pushed || updated.Watermark != "" {
+		t.Errorf("unexpected update: %+v", updated)
+	}
+
+	deleted := <-changesCh
+	if len(deleted.Tombstones) != 1 || deleted.Tombstones[0].Id != "2" || len(deleted.Redirects) != 0 {
+		t.Errorf("unexpected deletion: %+v", deleted)
+	}
+}
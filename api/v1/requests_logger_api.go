@@ -2,6 +2,7 @@ package v1
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 )
@@ -9,6 +10,8 @@ import (
 type LogRequestsInput struct {
 	RequestURL string    `json:"requestURL"`
 	HitTime    time.Time `json:"hitTime"`
+	// Hits counts the requests for the URL, including the ones answered from the cache of the plugin
+	Hits int64 `json:"hits"`
 }
 
 type LogResponse struct {
@@ -16,30 +19,99 @@ type LogResponse struct {
 	Message string `graphql:"message"`
 }
 
-func (gql *GraphQLClient) ExecuteLogRequestsMutation(requestsMap *map[string]time.Time) (LogResponse, error) {
+func (gql *GraphQLClient) ExecuteLogRequestsMutation(logsInput []LogRequestsInput) (LogResponse, error) {
 	var logMutation struct {
 		LogResponse `graphql:"logRequests(logRequestsInput: $logRequestsInput)"`
 	}
 
-	var logsInput []LogRequestsInput
+	vars := map[string]interface{}{
+		"logRequestsInput": logsInput,
+	}
+
+	client := gql.GetClient()
+	if client == nil {
+		return LogResponse{}, fmt.Errorf("GraphQL client not initialized")
+	}
 
-	// populate the logs input for the mutation
-	for key, val := range *requestsMap {
-		logsInput = append(logsInput, LogRequestsInput{
-			RequestURL: key,
-			HitTime:    val,
-		})
+	err := client.Mutate(context.Background(), &logMutation, vars)
+	if err != nil {
+		graphqlErrors.Inc("logRequests")
+		log.Println("GraphQL server not reachable!", err)
+		return LogResponse{}, err
+	}
+
+	return logMutation.LogResponse, nil
+}
+
+// RuleHitsInput is the number of requests matched by a rule, identified by its redirect id
+type RuleHitsInput struct {
+	RuleId   string    `json:"ruleId"`
+	Hits     int64     `json:"hits"`
+	FirstHit time.Time `json:"firstHit"`
+	LastHit  time.Time `json:"lastHit"`
+}
+
+// ExecuteRuleHitsMutation uploads the total hits of the rules, so the Central API can tell which redirects are still in use
+func (gql *GraphQLClient) ExecuteRuleHitsMutation(ruleHits []RuleHitsInput) (LogResponse, error) {
+	var hitsMutation struct {
+		LogResponse `graphql:"logRuleHits(ruleHitsInput: $ruleHitsInput)"`
 	}
 
 	vars := map[string]interface{}{
-		"logRequestsInput": logsInput,
+		"ruleHitsInput": ruleHits,
+	}
+
+	client := gql.GetClient()
+	if client == nil {
+		return LogResponse{}, fmt.Errorf("GraphQL client not initialized")
 	}
 
-	err := gql.GetClient().Mutate(context.Background(), &logMutation, vars)
+	err := client.Mutate(context.Background(), &hitsMutation, vars)
 	if err != nil {
+		graphqlErrors.Inc("logRuleHits")
 		log.Println("GraphQL server not reachable!", err)
 		return LogResponse{}, err
 	}
 
-	return logMutation.LogResponse, nil
+	return hitsMutation.LogResponse, nil
+}
+
+// MissingPageInput is a URL the upstream answered with an error status, with the pages linking to it
+type MissingPageInput struct {
+	URL        string          `json:"url"`
+	StatusCode int             `json:"statusCode"`
+	Hits       int64           `json:"hits"`
+	FirstSeen  time.Time       `json:"firstSeen"`
+	LastSeen   time.Time       `json:"lastSeen"`
+	Referrers  []ReferrerInput `json:"referrers"`
+}
+
+type ReferrerInput struct {
+	Referrer string `json:"referrer"`
+	Hits     int64  `json:"hits"`
+}
+
+// ExecuteMissingPagesMutation uploads the missing pages as candidates for new redirects
+func (gql *GraphQLClient) ExecuteMissingPagesMutation(missingPages []MissingPageInput) (LogResponse, error) {
+	var missingPagesMutation struct {
+		LogResponse `graphql:"logMissingPages(missingPagesInput: $missingPagesInput)"`
+	}
+
+	vars := map[string]interface{}{
+		"missingPagesInput": missingPages,
+	}
+
+	client := gql.GetClient()
+	if client == nil {
+		return LogResponse{}, fmt.Errorf("GraphQL client not initialized")
+	}
+
+	err := client.Mutate(context.Background(), &missingPagesMutation, vars)
+	if err != nil {
+		graphqlErrors.Inc("logMissingPages")
+		log.Println("GraphQL server not reachable!", err)
+		return LogResponse{}, err
+	}
+
+	return missingPagesMutation.LogResponse, nil
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultAdminURL is the admin API of the service running next to the commands, e.g. in the same container
+const defaultAdminURL = "http://localhost" + defaultAdminAddr
+
+// runCommand runs a maintenance subcommand instead of the service, e.g. `./app export -o redirects.csv`
+func runCommand(args []string) {
+	// The commands only read DB_FILE_PATH of the .env file, as the default of their -db flag
+	loadEnv()
+
+	switch args[0] {
+	case "export":
+		exportCommand(args[1:])
+	case "import":
+		importCommand(args[1:])
+	case "export-traefik":
+		exportTraefikCommand(args[1:])
+	case "verify":
+		verifyCommand(args[1:])
+	default:
+		log.Fatalf("Unknown command %q, expected export, import, export-traefik or verify", args[0])
+	}
+}
+
+/*
+exportCommand writes the stored redirects of all sources as CSV or JSON, or the indexed redirects
+as an Apache RewriteMap, an nginx snippet or a Netlify _redirects file.
+*/
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "", "csv, json, apache, nginx or netlify, defaults to the name of the output file or csv")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	dbPath := dbFlag(flags)
+	_ = flags.Parse(args)
+
+	if *format == "" {
+		*format = app.LegacyFormat(*output)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*output)), ".")
+		if *format == "" {
+			*format = app.CSVFormat
+		}
+	}
+	if *format == app.ApacheFormat || *format == app.NginxFormat || *format == app.NetlifyFormat {
+		exportLegacyRules(*format, *output, *dbPath)
+		return
+	}
+
+	db := openCommandDB(*dbPath)
+	redirects, err := app.LoadStoredRedirects(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	write := func(w io.Writer) error { return app.ExportRedirects(w, redirects, *format) }
+	if *output == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeFileAtomic(*output, write)
+	}
+	if err != nil {
+		log.Fatal("Error exporting redirects: ", err)
+	}
+	log.Printf("Exported %d redirects\n", len(redirects))
+}
+
+// exportLegacyRules writes the redirects the service would index in the format of another web server
+func exportLegacyRules(format, output, dbPath string) {
+	redirects := loadIndexedRules(dbPath)
+	var warnings []app.ExportWarning
+	write := func(w io.Writer) error {
+		var err error
+		warnings, err = app.ExportLegacyRules(w, redirects, format)
+		return err
+	}
+
+	var err error
+	if output == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeFileAtomic(output, write)
+	}
+	if err != nil {
+		log.Fatal("Error exporting redirects: ", err)
+	}
+
+	for _, warning := range warnings {
+		log.Println("Not exported as it is:", warning)
+	}
+	log.Printf("Exported %d of %d redirects\n", len(redirects)-len(warnings), len(redirects))
+}
+
+/*
+importCommand stores the redirects of a rules file or a legacy Apache, nginx or Netlify config as local overrides,
+which take precedence over all other sources. Nothing is imported while any row is invalid or any redirect of
+a legacy config can't be converted, unless they are skipped explicitly. The rows of an export belonging to another
+source are invalid. Once imported, a sync is triggered through the admin API of the running service.
+*/
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	skipInvalid := flags.Bool("skip-invalid", false, "import the valid rows even if some rows are invalid")
+	dryRun := flags.Bool("dry-run", false, "only validate the file")
+	format := flags.String("format", "", "apache, nginx or netlify for a legacy config, detected from the file name by default")
+	adminURL := flags.String("admin-url", defaultAdminURL, "admin API of the running service to trigger a sync on, empty to skip it")
+	dbPath := dbFlag(flags)
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: import [-skip-invalid] [-dry-run] [-format apache|nginx|netlify] [-admin-url url] [-db file] <rules file>")
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = app.LegacyFormat(path)
+	}
+
+	var redirects []api.Redirect
+	var convErrs []app.ConversionError
+	var sourceErrors []app.RowError
+	var err error
+	if *format == "" {
+		redirects, sourceErrors, err = app.ReadImportedRules(path)
+	} else {
+		redirects, convErrs, err = app.ReadLegacyRulesFile(path, *format)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for _, convErr := range convErrs {
+		log.Println(convErr)
+		if !convErr.Warning {
+			failed++
+		}
+	}
+	rowErrors := append(sourceErrors, app.ValidateRedirects(redirects)...)
+	invalid := make(map[int]bool, len(rowErrors))
+	for _, rowErr := range rowErrors {
+		log.Println(rowErr)
+		invalid[rowErr.Row] = true
+	}
+	total := len(redirects) + failed
+	if count := failed + len(invalid); count > 0 && !*skipInvalid {
+		log.Fatalf("%d of %d rows are invalid, nothing imported", count, total)
+	}
+
+	valid := redirects[:0]
+	for i, r := range redirects {
+		if !invalid[i+1] {
+			valid = append(valid, r)
+		}
+	}
+
+	if *dryRun {
+		log.Printf("%d of %d rows are valid, nothing imported in a dry run\n", len(valid), total)
+		return
+	}
+
+	if err := app.ImportLocalRedirects(openCommandDB(*dbPath), valid); err != nil {
+		log.Fatal("Error importing redirects: ", err)
+	}
+	log.Printf("Imported %d of %d rows as local overrides\n", len(valid), total)
+
+	if *adminURL == "" {
+		log.Println("The local overrides are applied with the next sync, or right away with POST /sync on the admin API")
+		return
+	}
+	if err := triggerSync(*adminURL); err != nil {
+		log.Printf("The local overrides are applied with the next sync, triggering one failed: %v\n", err)
+		log.Printf("Apply them right away with: curl -X POST %s/sync\n", strings.TrimSuffix(*adminURL, "/"))
+		return
+	}
+	log.Println("Triggered a sync to apply the local overrides")
+}
+
+// triggerSync asks the running service to sync right away, so it applies the imported local overrides
+func triggerSync(adminURL string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(strings.TrimSuffix(adminURL, "/")+"/sync", "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+/*
+exportTraefikCommand writes the redirects indexed from the sqlite records as a Traefik dynamic configuration.
+The file is replaced at once, so it can be watched by the Traefik file provider.
+*/
+func exportTraefikCommand(args []string) {
+	flags := flag.NewFlagSet("export-traefik", flag.ExitOnError)
+	hosts := flags.String("hosts", "", "comma separated hosts to route the path rules for, defaults to any host")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	dbPath := dbFlag(flags)
+	_ = flags.Parse(args)
+
+	var hostList []string
+	if *hosts != "" {
+		hostList = strings.Split(*hosts, ",")
+	}
+
+	config, warnings := app.TraefikDynamicConfig(loadIndexedRules(*dbPath), hostList)
+	for _, warning := range warnings {
+		log.Println("Not exported as it is:", warning)
+	}
+
+	write := func(w io.Writer) error { return app.WriteTraefikConfig(w, config, warnings) }
+	if *output == "" {
+		if err := write(os.Stdout); err != nil {
+			log.Fatal("Error exporting the Traefik configuration: ", err)
+		}
+		return
+	}
+	if err := writeFileAtomic(*output, write); err != nil {
+		log.Fatal("Error exporting the Traefik configuration: ", err)
+	}
+	log.Println("Exported the Traefik configuration to", *output)
+}
+
+/*
+verifyCommand follows the redirects of a CSV or JSON list of URLs through the stored redirects, offline,
+and reports whether they end up at the expected destinations. It exits with an error when any URL fails.
+*/
+func verifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json report, defaults to the extension of the output file or csv")
+	output := flags.String("o", "", "output file, defaults to stdout")
+	dbPath := dbFlag(flags)
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatal("Usage: verify [-format csv|json] [-o report.csv] [-db file] <urls.csv|urls.json>")
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*output)), ".")
+		if *format == "" {
+			*format = app.CSVFormat
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Error opening the URLs file: ", err)
+	}
+	inputFormat := app.CSVFormat
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		inputFormat = app.JSONFormat
+	}
+	cases, err := app.ReadVerifyCases(file, inputFormat)
+	file.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report := loadRedirectManager(*dbPath).IndexedRedirects.Verify(cases)
+
+	write := func(w io.Writer) error { return app.WriteVerifyReport(w, report, *format) }
+	if *output == "" {
+		err = write(os.Stdout)
+	} else {
+		err = writeFileAtomic(*output, write)
+	}
+	if err != nil {
+		log.Fatal("Error writing the report: ", err)
+	}
+
+	log.Printf("%d of %d URLs passed\n", report.Passed, len(report.Results))
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadRedirectManager indexes the stored redirects with the same precedence of the sources as the service
+func loadRedirectManager(dbPath string) *app.RedirectManager {
+	db := openCommandDB(dbPath)
+	sources := []app.RuleSource{app.NewLocalOverrideSource(db), app.NewFileSource(""), app.NewCentralSource(nil)}
+	redirectManager := app.NewRedirectManager(db, sources, defaultSyncInterval, app.DeletionThreshold{})
+	redirectManager.PopulateMapsWithDataFromDB()
+
+	return redirectManager
+}
+
+// loadIndexedRules returns the redirects that the service would index
+func loadIndexedRules(dbPath string) []api.Redirect {
+	return loadRedirectManager(dbPath).IndexedRules()
+}
+
+// writeFileAtomic replaces the file by renaming a completely written temporary file
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// dbFlag adds the -db flag of the sqlite file a command works on, which defaults to the DB_FILE_PATH of the service
+func dbFlag(flags *flag.FlagSet) *string {
+	return flags.String("db", os.Getenv("DB_FILE_PATH"), "sqlite file of the service, defaults to DB_FILE_PATH")
+}
+
+/*
+openCommandDB opens the sqlite file of the service, it is neither created nor migrated by a command.
+The schema has to be the one of this version of the app, the service migrates it when it starts.
+*/
+func openCommandDB(path string) *sql.DB {
+	if path == "" {
+		log.Fatal("No sqlite file given, set -db or DB_FILE_PATH")
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Fatal("Error opening the sqlite file: ", err)
+	}
+
+	// mode=rw fails instead of creating a missing file
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=rw&_busy_timeout=5000")
+	if err != nil {
+		log.Fatal("Database connection issues: ", err)
+	}
+	if err := app.CheckSchemaVersion(db); err != nil {
+		log.Fatal(err)
+	}
+
+	return db
+}
@@ -2,29 +2,78 @@ package main
 
 import (
 	"database/sql"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"time"
+)
+
+const defaultSyncInterval = 7 * 24 * time.Hour
+
+// defaultAdminAddr is the listen address of the admin API, apart from the match endpoint queried by the plugin
+const defaultAdminAddr = ":8082"
+
+// The app either syncs with the Central API, or runs standalone on a local rules file
+const (
+	centralMode = "central"
+	fileMode    = "file"
 )
 
 type AppConfig struct {
-	clientName   string
-	clientSecret string
-	serverURL    string
-	jwtSecret    string
-	logFilePath  string
-	dbFilePath   string
+	mode              string
+	clientName        string
+	clientSecret      string
+	serverURL         string
+	jwtSecret         string
+	hostId            string
+	logFilePath       string
+	dbFilePath        string
+	rulesFilePath     string
+	syncInterval      time.Duration
+	deletionThreshold app.DeletionThreshold
+	webhookSecret     string
+	subscribe         bool
+	adminAddr         string
+	maxSyncStaleness  time.Duration
 }
 
 func NewAppConfig() *AppConfig {
 	loadEnv()
-	return &AppConfig{
-		clientName:   os.Getenv("CLIENT_NAME"),
-		clientSecret: os.Getenv("CLIENT_SECRET"),
-		serverURL:    os.Getenv("SERVER_URL"),
-		jwtSecret:    os.Getenv("JWT_SECRET"),
-		logFilePath:  os.Getenv("LOG_FILE_PATH"),
-		dbFilePath:   os.Getenv("DB_FILE_PATH"),
+	config := &AppConfig{
+		mode:              getMode(),
+		clientName:        os.Getenv("CLIENT_NAME"),
+		clientSecret:      os.Getenv("CLIENT_SECRET"),
+		serverURL:         os.Getenv("SERVER_URL"),
+		jwtSecret:         os.Getenv("JWT_SECRET"),
+		hostId:            os.Getenv("HOST_ID"),
+		logFilePath:       os.Getenv("LOG_FILE_PATH"),
+		dbFilePath:        os.Getenv("DB_FILE_PATH"),
+		rulesFilePath:     os.Getenv("RULES_FILE_PATH"),
+		syncInterval:      getDurationEnv("SYNC_INTERVAL", defaultSyncInterval),
+		deletionThreshold: getDeletionThresholdEnv("DELETION_THRESHOLD"),
+		webhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+		subscribe:         os.Getenv("SUBSCRIBE_UPDATES") == "true",
+		adminAddr:         getEnv("ADMIN_ADDR", defaultAdminAddr),
+	}
+	// Missing a sync is fine, the app isn't ready once it missed the next one as well
+	config.maxSyncStaleness = getDurationEnv("MAX_SYNC_STALENESS", 2*config.syncInterval)
+
+	return config
+}
+
+func getMode() string {
+	switch mode := os.Getenv("MODE"); mode {
+	case "", centralMode:
+		return centralMode
+	case fileMode:
+		if os.Getenv("RULES_FILE_PATH") == "" {
+			log.Fatal("RULES_FILE_PATH is required in the file mode")
+		}
+		return fileMode
+	default:
+		log.Fatalf("Invalid MODE %q, expected %q or %q", mode, centralMode, fileMode)
+		return ""
 	}
 }
 
@@ -39,8 +88,42 @@ func loadEnv() {
 	}
 }
 
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// getDurationEnv parses a duration like "15m" from the environment, falling back to the default value
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s value %q, using %s\n", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return duration
+}
+
+func getDeletionThresholdEnv(key string) app.DeletionThreshold {
+	threshold, err := app.ParseDeletionThreshold(os.Getenv(key))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+
+	return threshold
+}
+
 func dbConnect(file string) *sql.DB {
-	db, err := sql.Open("sqlite3", file)
+	// WAL lets the redirects be read while a sync transaction is being written
+	db, err := sql.Open("sqlite3", file+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		log.Fatal("Database connection issues: ", err)
 	}
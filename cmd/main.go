@@ -1,28 +1,67 @@
 package main
 
 import (
+	"context"
+	"errors"
 	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
 	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
 	"github.com/TRIMM/redirects-traefik-middleware/pkg/v1/handlers"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout bounds the wait for the requests in flight when stopping, within the grace period of docker stop
+const shutdownTimeout = 5 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	log.Println("Starting redirects-traefik-middleware")
 
-	// Create needed configuration for the authentication
 	config := NewAppConfig()
-	authData := api.NewAuthData(config.clientName, config.clientSecret, config.serverURL, config.jwtSecret)
-	graphqlClient := api.NewGraphQLClient(authData)
+	log.Println("Running in the mode:", config.mode)
+
+	// Create needed configuration for the authentication, the file mode runs without the Central API
+	var graphqlClient *api.GraphQLClient
+	if config.mode == centralMode {
+		authData := api.NewAuthData(config.clientName, config.clientSecret, config.serverURL, config.jwtSecret)
+		graphqlClient = api.NewGraphQLClient(authData, config.hostId)
+	}
 
 	logger := app.NewLogger(config.logFilePath, graphqlClient)
-	logger.SendLogsWeekly()
+	if graphqlClient != nil {
+		logger.SendLogsWeekly()
+	}
+
+	db := dbConnect(config.dbFilePath)
+	if err := app.Migrate(db); err != nil {
+		log.Fatal("Database migration failed: ", err)
+	}
 
-	redirectManager := app.NewRedirectManager(dbConnect(config.dbFilePath), graphqlClient)
+	// Sources in precedence order: local overrides, the rules file and the Central API
+	sources := []app.RuleSource{app.NewLocalOverrideSource(db)}
+	var fileSource *app.FileSource
+	if config.rulesFilePath != "" {
+		fileSource = app.NewFileSource(config.rulesFilePath)
+		sources = append(sources, fileSource)
+	}
+	var centralSource *app.CentralSource
+	if graphqlClient != nil {
+		centralSource = app.NewCentralSource(graphqlClient)
+		sources = append(sources, centralSource)
+	}
+
+	redirectManager := app.NewRedirectManager(db, sources, config.syncInterval, config.deletionThreshold)
 	redirectManager.PopulateMapsWithDataFromDB()
 
-	redirectsCh := make(chan []api.Redirect)
+	redirectsCh := make(chan api.RedirectChanges)
 	errCh := make(chan error)
 
 	// Start the go-routine for fetching & syncing the redirects periodically
@@ -33,11 +72,86 @@ func main() {
 		redirectManager.FetchRedirectsOverChannel(redirectsCh, errCh)
 	}()
 	go redirectManager.SyncRedirects(redirectsCh, errCh)
+	// The conflicts between the rules are analyzed in the background, once the syncs stopped changing them
+	go redirectManager.AnalyzeConflictsOnChange()
+
+	// Count the hits of the rules, editors see which redirects are still in use through the Central API
+	go redirectManager.PersistRuleHits()
+	// The missing pages reported by the plugin are candidates for new redirects
+	missingPages := app.NewMissingPages(db)
+	if graphqlClient != nil {
+		redirectManager.ReportRuleHitsWeekly(graphqlClient)
+		missingPages.ReportWeekly(graphqlClient)
+	}
 
-	NewHTTPServer(logger, redirectManager)
+	// Optionally receive the changes live, in between the periodic syncs
+	if config.subscribe && centralSource != nil {
+		go redirectManager.SubscribeRedirects(centralSource, redirectsCh, errCh)
+	}
+	if fileSource != nil {
+		go fileSource.Watch(func() { redirectManager.TriggerSync() })
+	}
+
+	go NewAdminServer(config, redirectManager)
+	NewHTTPServer(config, logger, redirectManager, missingPages, graphqlClient)
 }
 
-func NewHTTPServer(logger *app.Logger, redirectManager *app.RedirectManager) {
+func NewHTTPServer(config *AppConfig, logger *app.Logger, redirectManager *app.RedirectManager, missingPages *app.MissingPages, graphqlClient *api.GraphQLClient) {
 	http.HandleFunc("/", handlers.GetRedirectMatch(logger, redirectManager))
-	log.Fatal(http.ListenAndServe(":8081", nil))
+	http.HandleFunc("GET /healthz", handlers.GetHealth())
+	http.HandleFunc("GET /readyz", handlers.GetReadiness(redirectManager, graphqlClient, config.maxSyncStaleness))
+	http.HandleFunc("POST /missing-pages", handlers.ReceiveMissingPages(missingPages))
+	http.HandleFunc("POST /cache-hits", handlers.ReceiveCachedHits(logger))
+	if config.webhookSecret != "" {
+		http.HandleFunc("POST /webhook", handlers.ReceiveWebhook(config.webhookSecret, config.hostId, redirectManager))
+	}
+
+	server := &http.Server{Addr: ":8081"}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	waitForShutdown(server, logger, redirectManager)
+}
+
+// waitForShutdown blocks until the app is stopped, then finishes the requests in flight and writes out what is kept in memory
+func waitForShutdown(server *http.Server, logger *app.Logger, redirectManager *app.RedirectManager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	log.Println("Shutting down redirects-traefik-middleware")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down the server:", err)
+	}
+	if err := logger.Close(); err != nil {
+		log.Println("Error flushing the request log:", err)
+	}
+	if err := redirectManager.FlushRuleHits(); err != nil {
+		log.Println("Error storing the rule hits:", err)
+	}
+}
+
+/*
+NewAdminServer serves the admin API on its own listener, so it can be kept away from the traffic of the plugin.
+Everything changing the rules or exposing them in bulk is served here, the compose file only publishes it on localhost.
+*/
+func NewAdminServer(config *AppConfig, redirectManager *app.RedirectManager) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sync", handlers.TriggerSync(redirectManager))
+	mux.HandleFunc("GET /sync/status", handlers.GetSyncStatus(redirectManager))
+	mux.HandleFunc("POST /sync/deletions/approve", handlers.ApprovePendingDeletions(redirectManager))
+	mux.HandleFunc("GET /export/traefik", handlers.GetTraefikConfig(redirectManager))
+	mux.HandleFunc("GET /metrics", handlers.GetMetrics())
+	mux.HandleFunc("GET /rules", handlers.ListRules(redirectManager))
+	mux.HandleFunc("GET /rules/{id...}", handlers.GetRule(redirectManager))
+	mux.HandleFunc("POST /explain", handlers.ExplainMatch(redirectManager))
+	mux.HandleFunc("POST /verify", handlers.VerifyRedirects(redirectManager))
+	mux.HandleFunc("GET /conflicts", handlers.GetConflicts(redirectManager))
+	log.Println("Serving the admin API on", config.adminAddr)
+	log.Fatal(http.ListenAndServe(config.adminAddr, mux))
 }
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// DeletionThreshold limits how many redirects a single sync may delete, the zero value allows everything
+type DeletionThreshold struct {
+	Count   int
+	Percent float64
+}
+
+// pendingDeletions are deletions held back by the DeletionThreshold until an admin approves them
+type pendingDeletions struct {
+	ids []string
+	// watermark is where the sync resumes once the deletions are approved
+	watermark string
+}
+
+// ParseDeletionThreshold parses either a percentage like "25%" or an absolute count like "500"
+func ParseDeletionThreshold(value string) (DeletionThreshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DeletionThreshold{}, nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return DeletionThreshold{}, fmt.Errorf("invalid deletion threshold percentage %q", value)
+		}
+		return DeletionThreshold{Percent: percent}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return DeletionThreshold{}, fmt.Errorf("invalid deletion threshold count %q", value)
+	}
+
+	return DeletionThreshold{Count: count}, nil
+}
+
+// Exceeds reports whether deleting the given number out of the total number of redirects crosses the threshold
+func (t DeletionThreshold) Exceeds(deleted int, total int) bool {
+	if deleted == 0 {
+		return false
+	}
+	if t.Count > 0 && deleted > t.Count {
+		return true
+	}
+
+	return t.Percent > 0 && total > 0 && float64(deleted)*100/float64(total) > t.Percent
+}
+
+func (t DeletionThreshold) String() string {
+	if t.Percent > 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+	if t.Count > 0 {
+		return strconv.Itoa(t.Count)
+	}
+
+	return "none"
+}
+
+// ApprovePendingDeletions applies the deletions held back by the DeletionThreshold of every source and returns their number
+func (rm *RedirectManager) ApprovePendingDeletions() (int, error) {
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+
+	approved, deleted := 0, 0
+	for _, set := range rm.sources {
+		if set.pending == nil {
+			continue
+		}
+
+		count, err := rm.approveDeletions(set)
+		if err != nil {
+			return deleted, err
+		}
+		approved++
+		deleted += count
+	}
+	if approved == 0 {
+		return 0, fmt.Errorf("no pending deletions")
+	}
+
+	log.Printf("Approved %d pending redirect deletions\n", deleted)
+	rm.scheduleConflictAnalysis()
+
+	return deleted, nil
+}
+
+// approveDeletions applies the pending deletions of a source, the caller holds the syncMu
+func (rm *RedirectManager) approveDeletions(set *ruleSet) (int, error) {
+	var plan syncPlan
+	for _, id := range set.pending.ids {
+		// Redirects may have been deleted by a later sync already
+		if _, ok := set.redirects[id]; ok {
+			plan.deleted = append(plan.deleted, id)
+		}
+	}
+
+	rm.mu.RLock()
+	state := SyncState{
+		Source:         set.source.Name(),
+		LastSyncTime:   set.status.LastSuccess,
+		Watermark:      set.pending.watermark,
+		RuleSetVersion: rm.status.RuleSetVersion + 1,
+		RuleCount:      len(set.redirects) - len(plan.deleted),
+	}
+	rm.mu.RUnlock()
+
+	if err := rm.storeSyncPlan(set, &plan, state); err != nil {
+		return 0, fmt.Errorf("error storing the approved deletions of the %s source: %v", set.source.Name(), err)
+	}
+
+	rm.applySyncPlan(set, &plan)
+	recordSyncPlan(set, &plan)
+
+	rm.mu.Lock()
+	set.watermark = set.pending.watermark
+	set.pending = nil
+	set.status.Deleted = len(plan.deleted)
+	set.status.PendingDeletions = 0
+	set.status.RuleCount = len(set.redirects)
+	rm.status.RuleSetVersion = state.RuleSetVersion
+	rm.status.RuleCount = rm.ruleCount()
+	rm.mu.Unlock()
+
+	return len(plan.deleted), nil
+}
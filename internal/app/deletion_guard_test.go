@@ -0,0 +1,132 @@
+package app
+
+import (
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"testing"
+)
+
+func TestParseDeletionThreshold(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  DeletionThreshold
+		expectErr bool
+	}{
+		{value: "", expected: DeletionThreshold{}},
+		{value: "25%", expected: DeletionThreshold{Percent: 25}},
+		{value: "500", expected: DeletionThreshold{Count: 500}},
+		{value: "150%", expectErr: true},
+		{value: "-1", expectErr: true},
+		{value: "many", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			threshold, err := ParseDeletionThreshold(tc.value)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if threshold != tc.expected {
+				t.Errorf("unexpected threshold: got %+v want %+v", threshold, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRedirectManager_HoldsMassDeletion(t *testing.T) {
+	rm := newTestRedirectManager(t)
+	rm.deletionThreshold = DeletionThreshold{Percent: 50}
+
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"},
+			{Id: "2", FromURL: "/home/careers", ToURL: "/careers"},
+			{Id: "3", FromURL: "/home/contact", ToURL: "/contact"},
+		},
+		Watermark: "w1",
+		Full:      true,
+	})
+
+	// A truncated snapshot would delete two out of three redirects
+	err := rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/tasks"}},
+		Watermark: "w2",
+		Full:      true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+
+	status := rm.Status().Sources[CentralSourceName]
+	if status.PendingDeletions != 2 || status.Deleted != 0 || status.Updated != 1 {
+		t.Errorf("unexpected sync status: %+v", status)
+	}
+	if rm.Watermark(CentralSourceName) != "w1" {
+		t.Errorf("watermark advanced while deletions are pending: got %v want %v", rm.Watermark(CentralSourceName), "w1")
+	}
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); !ok {
+		t.Errorf("held back redirect was deleted")
+	}
+
+	deleted, err := rm.ApprovePendingDeletions()
+	if err != nil || deleted != 2 {
+		t.Fatalf("unexpected approval result: %v deleted, %v", deleted, err)
+	}
+
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); ok {
+		t.Errorf("approved deletion still matches")
+	}
+	if rm.Watermark(CentralSourceName) != "w2" {
+		t.Errorf("watermark not advanced after the approval: got %v want %v", rm.Watermark(CentralSourceName), "w2")
+	}
+	if status := rm.Status(); status.PendingDeletions != 0 || status.RuleCount != 1 {
+		t.Errorf("unexpected sync status after the approval: %+v", status)
+	}
+
+	if _, err := rm.ApprovePendingDeletions(); err == nil {
+		t.Errorf("expected an error without pending deletions")
+	}
+}
+
+func TestRedirectManager_KeepsPendingDeletionsOfOtherSources(t *testing.T) {
+	db := newTestRedirectManager(t).db
+	rm := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db), NewCentralSource(nil)}, 0, DeletionThreshold{Percent: 50})
+	rm.PopulateMapsWithDataFromDB()
+
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"},
+			{Id: "2", FromURL: "/home/careers", ToURL: "/careers"},
+			{Id: "3", FromURL: "/home/contact", ToURL: "/contact"},
+		},
+		Watermark: "w1",
+		Full:      true,
+	})
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"}},
+		Watermark: "w2",
+		Full:      true,
+	})
+
+	// Neither the sync of another source nor a push of the same source replace the held deletions
+	_ = rm.applyChanges(api.RedirectChanges{Source: LocalSourceName, Full: true})
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "4", FromURL: "/home/about", ToURL: "/about"}},
+		Pushed:    true,
+	})
+	if status := rm.Status(); status.PendingDeletions != 2 || status.Sources[CentralSourceName].PendingDeletions != 2 {
+		t.Errorf("pending deletions lost: %+v", status)
+	}
+
+	deleted, err := rm.ApprovePendingDeletions()
+	if err != nil || deleted != 2 {
+		t.Fatalf("unexpected approval result: %v deleted, %v", deleted, err)
+	}
+	if rm.Watermark(CentralSourceName) != "w2" {
+		t.Errorf("watermark not advanced after the approval: got %v want %v", rm.Watermark(CentralSourceName), "w2")
+	}
+}
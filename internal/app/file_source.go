@@ -0,0 +1,229 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileWatchInterval is how often the rules file is checked for changes
+const fileWatchInterval = 2 * time.Second
+
+// FileSource provides the redirects of a local YAML, JSON or CSV file, e.g. for air-gapped or development setups
+type FileSource struct {
+	path string
+}
+
+// RulesFile is the format of a rules file, the id defaults to the fromDomain or fromURL
+type RulesFile struct {
+	Redirects []FileRedirect `json:"redirects" yaml:"redirects"`
+}
+
+type FileRedirect struct {
+	Id         string    `json:"id,omitempty" yaml:"id,omitempty"`
+	FromURL    string    `json:"fromURL,omitempty" yaml:"fromURL,omitempty"`
+	FromDomain string    `json:"fromDomain,omitempty" yaml:"fromDomain,omitempty"`
+	ToURL      string    `json:"toURL" yaml:"toURL"`
+	StatusCode int       `json:"statusCode,omitempty" yaml:"statusCode,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt,omitempty" yaml:"updatedAt,omitempty"`
+	// Source is only set by an export, the rows of other sources than the local one aren't imported
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (fs *FileSource) Name() string {
+	return FileSourceName
+}
+
+// FetchChanges returns a full snapshot of the file once it changed, the watermark is the file version
+func (fs *FileSource) FetchChanges(watermark string) (api.RedirectChanges, error) {
+	version, err := fs.version()
+	if err != nil {
+		return api.RedirectChanges{}, err
+	}
+
+	if version == watermark {
+		return api.RedirectChanges{Source: FileSourceName, Watermark: watermark}, nil
+	}
+
+	redirects, err := ReadRulesFile(fs.path)
+	if err != nil {
+		return api.RedirectChanges{}, err
+	}
+
+	return api.RedirectChanges{Source: FileSourceName, Redirects: redirects, Watermark: version, Full: true}, nil
+}
+
+// Watch calls onChange whenever the file is modified
+func (fs *FileSource) Watch(onChange func()) {
+	lastVersion, _ := fs.version()
+	for range time.Tick(fileWatchInterval) {
+		version, err := fs.version()
+		if err != nil || version == lastVersion {
+			continue
+		}
+
+		lastVersion = version
+		log.Println("Rules file changed:", fs.path)
+		onChange()
+	}
+}
+
+func (fs *FileSource) version() (string, error) {
+	info, err := os.Stat(fs.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// ReadRulesFile reads the redirects of a .json, .yaml, .yml or .csv rules file
+func ReadRulesFile(path string) ([]api.Redirect, error) {
+	fileRedirects, err := readRulesFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	redirects := make([]api.Redirect, 0, len(fileRedirects))
+	for _, fr := range fileRedirects {
+		redirects = append(redirects, fr.toRedirect())
+	}
+
+	return redirects, nil
+}
+
+/*
+ReadImportedRules reads a rules file to import as local overrides. The rows of an export belonging to another source
+are returned as row errors, importing them would pin the redirects of that source as local overrides.
+*/
+func ReadImportedRules(path string) ([]api.Redirect, []RowError, error) {
+	fileRedirects, err := readRulesFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rowErrors []RowError
+	redirects := make([]api.Redirect, 0, len(fileRedirects))
+	for i, fr := range fileRedirects {
+		r := fr.toRedirect()
+		if fr.Source != "" && fr.Source != LocalSourceName {
+			rowErrors = append(rowErrors, RowError{Row: i + 1, Id: r.Id, Err: fmt.Errorf("the redirect belongs to the %s source, only local redirects are imported", fr.Source)})
+		}
+		redirects = append(redirects, r)
+	}
+
+	return redirects, rowErrors, nil
+}
+
+func readRulesFile(path string) ([]FileRedirect, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	var rulesFile RulesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &rulesFile)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &rulesFile)
+	case ".csv":
+		rulesFile.Redirects, err = readRulesCSV(content)
+	default:
+		return nil, fmt.Errorf("unsupported rules file format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rules file %s: %v", path, err)
+	}
+
+	return rulesFile.Redirects, nil
+}
+
+/*
+readRulesCSV reads CSV rules with a header row naming the columns, e.g.
+
+	fromURL,fromDomain,toURL
+	/school/assignments,,/school/items
+
+The id, source, statusCode and updatedAt (RFC 3339) columns are optional.
+*/
+func readRulesCSV(content []byte) ([]FileRedirect, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["toURL"]; !ok {
+		return nil, fmt.Errorf("missing toURL column in the CSV header")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	redirects := make([]FileRedirect, 0, len(records)-1)
+	for i, record := range records[1:] {
+		fr := FileRedirect{
+			Id:         field(record, "id"),
+			FromURL:    field(record, "fromURL"),
+			FromDomain: field(record, "fromDomain"),
+			ToURL:      field(record, "toURL"),
+			Source:     field(record, "source"),
+		}
+		if statusCode := field(record, "statusCode"); statusCode != "" {
+			fr.StatusCode, err = strconv.Atoi(statusCode)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid statusCode: %v", i+2, err)
+			}
+		}
+		if updatedAt := field(record, "updatedAt"); updatedAt != "" {
+			fr.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt)
+			if err != nil {
+				// The header is line 1
+				return nil, fmt.Errorf("line %d: invalid updatedAt: %v", i+2, err)
+			}
+		}
+		redirects = append(redirects, fr)
+	}
+
+	return redirects, nil
+}
+
+func (fr FileRedirect) toRedirect() api.Redirect {
+	r := api.Redirect{
+		Id:         fr.Id,
+		FromURL:    fr.FromURL,
+		FromDomain: fr.FromDomain,
+		ToURL:      fr.ToURL,
+		UpdatedAt:  fr.UpdatedAt,
+		StatusCode: fr.StatusCode,
+	}
+	if r.Id == "" {
+		r.Id = ruleKey(&r)
+	}
+
+	return r
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRulesFile_Formats(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "YAML",
+			file:    "rules.yaml",
+			content: "redirects:\n  - id: careers\n    fromURL: /home/careers\n    toURL: /careers\n",
+		},
+		{
+			name:    "JSON",
+			file:    "rules.json",
+			content: `{"redirects": [{"id": "careers", "fromURL": "/home/careers", "toURL": "/careers"}]}`,
+		},
+		{
+			name:    "CSV",
+			file:    "rules.csv",
+			content: "id,fromURL,fromDomain,toURL\ncareers,/home/careers,,/careers\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to write rules file: %v", err)
+			}
+
+			redirects, err := ReadRulesFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read rules file: %v", err)
+			}
+
+			if len(redirects) != 1 {
+				t.Fatalf("unexpected number of redirects: got %v want %v", len(redirects), 1)
+			}
+			r := redirects[0]
+			if r.Id != "careers" || r.FromURL != "/home/careers" || r.FromDomain != "" || r.ToURL != "/careers" {
+				t.Errorf("unexpected redirect: %+v", r)
+			}
+		})
+	}
+}
+
+func TestReadRulesFile_DefaultId(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.csv")
+	if err := os.WriteFile(path, []byte("fromDomain,toURL\nold-domain.com$,https://new-domain.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+
+	redirects, err := ReadRulesFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read rules file: %v", err)
+	}
+
+	if len(redirects) != 1 || redirects[0].Id != "domain:old-domain.com$" {
+		t.Errorf("unexpected default id: %+v", redirects)
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// logQueueSize bounds the lines waiting to be written, lines are dropped rather than blocking the matches
+	logQueueSize = 10000
+	// logBufferSize is the size of the file buffer, which is written out once it is full
+	logBufferSize = 64 << 10
+	// logFlushInterval is the longest time a line stays in the file buffer
+	logFlushInterval = time.Second
+)
+
+/*
+logWriter appends lines to a file from a single goroutine, through a buffered file handle that stays open.
+The lines are queued on a channel, so the callers never wait for the file.
+*/
+type logWriter struct {
+	fileName string
+	lines    chan string
+	flushes  chan chan error
+	done     chan struct{}
+	// mutex guards closed, so no line is sent on the closed channel
+	mutex    sync.RWMutex
+	closed   bool
+	closeErr error
+	dropped  atomic.Int64
+}
+
+func newLogWriter(fileName string) *logWriter {
+	w := &logWriter{
+		fileName: fileName,
+		lines:    make(chan string, logQueueSize),
+		flushes:  make(chan chan error),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+
+	return w
+}
+
+// tryWrite queues a line without blocking, it is dropped and counted when the queue is full
+func (w *logWriter) tryWrite(line string) error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.closed {
+		return fmt.Errorf("log writer closed")
+	}
+
+	select {
+	case w.lines <- line:
+	default:
+		w.dropped.Add(1)
+		droppedLogLines.Inc()
+	}
+
+	return nil
+}
+
+// write queues a line, waiting for room in the queue
+func (w *logWriter) write(line string) error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.closed {
+		return fmt.Errorf("log writer closed")
+	}
+	w.lines <- line
+
+	return nil
+}
+
+// Flush writes the queued lines to the file
+func (w *logWriter) Flush() error {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	// The lines were flushed when closing
+	if w.closed {
+		return nil
+	}
+
+	ack := make(chan error)
+	w.flushes <- ack
+
+	return <-ack
+}
+
+// Close writes the queued lines to the file and closes it, lines written afterward return an error
+func (w *logWriter) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.lines)
+	w.mutex.Unlock()
+
+	<-w.done
+
+	return w.closeErr
+}
+
+func (w *logWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	var file *os.File
+	var buffered *bufio.Writer
+	// reset closes the file after an error, it is opened again for the next line
+	reset := func() {
+		if file != nil {
+			if err := file.Close(); err != nil {
+				log.Println("Error closing file:", err)
+			}
+		}
+		file, buffered = nil, nil
+	}
+	flush := func() error {
+		if buffered == nil {
+			return nil
+		}
+		if err := buffered.Flush(); err != nil {
+			reset()
+			return fmt.Errorf("failed to write to log file: %v", err)
+		}
+		return nil
+	}
+	write := func(line string) {
+		if buffered == nil {
+			opened, err := os.OpenFile(w.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Println("Error opening the request log:", err)
+				droppedLogLines.Inc()
+				return
+			}
+			file, buffered = opened, bufio.NewWriterSize(opened, logBufferSize)
+		}
+		if _, err := buffered.WriteString(line); err != nil {
+			log.Println("Failed to write to log file:", err)
+			reset()
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-w.lines:
+			if !ok {
+				w.closeErr = flush()
+				reset()
+				return
+			}
+			write(line)
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				log.Println("Error flushing the request log:", err)
+			}
+		case ack := <-w.flushes:
+			// The lines queued before the flush are written first
+			for queued := len(w.lines); queued > 0; queued-- {
+				write(<-w.lines)
+			}
+			ack <- flush()
+		}
+	}
+}
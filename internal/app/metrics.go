@@ -0,0 +1,56 @@
+package app
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/metrics"
+)
+
+// The results of matching a request against the index
+const (
+	MatchDomain = "domain"
+	MatchPath   = "path"
+	MatchMiss   = "miss"
+)
+
+var (
+	matchRequests = metrics.NewCounter("redirects_match_requests_total",
+		"Requests matched against the indexed rules, by result: a domain rule, a path rule or a miss.", "result")
+	indexedRules = metrics.NewGauge("redirects_indexed_rules",
+		"Rules in the index, by bucket: the domain rules or the path rules of the LengthMap.", "bucket")
+	syncDuration = metrics.NewHistogram("redirects_sync_duration_seconds",
+		"Duration of fetching and of applying the changes of a rule source, by phase: fetch or apply.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}, "source", "phase")
+	syncChanges = metrics.NewCounter("redirects_sync_changes_total",
+		"Redirects changed by the syncs, by rule source and change: added, updated or deleted.", "source", "change")
+	syncErrors = metrics.NewCounter("redirects_sync_errors_total",
+		"Failed fetches or applies of the changes of a rule source.", "source")
+	missingPages = metrics.NewCounter("redirects_missing_pages_total",
+		"Requests the upstream answered with an error status, as reported by the plugin, by status code.", "status")
+	logUploads = metrics.NewCounter("redirects_log_uploads_total",
+		"Uploads of the logged requests to the Central API, by result: success or failure.", "result")
+	droppedLogLines = metrics.NewCounter("redirects_log_dropped_lines_total",
+		"Requests left out of the request log, because its queue was full or the file couldn't be opened.")
+)
+
+func init() {
+	for _, result := range []string{MatchDomain, MatchPath, MatchMiss} {
+		matchRequests.Add(0, result)
+	}
+	for _, result := range []string{"success", "failure"} {
+		logUploads.Add(0, result)
+	}
+}
+
+// recordIndexedRules updates the rule counts of the index buckets
+func (idx *IndexedRedirects) recordIndexedRules() {
+	idx.mu.RLock()
+	domainRules, pathRules := len(idx.DomainRules), 0
+	for _, prefixes := range idx.LengthMap {
+		for _, rules := range prefixes {
+			pathRules += len(rules)
+		}
+	}
+	idx.mu.RUnlock()
+
+	indexedRules.Set(float64(domainRules), MatchDomain)
+	indexedRules.Set(float64(pathRules), MatchPath)
+}
@@ -0,0 +1,8 @@
+-- Databases created before the migrations already have this table
+CREATE TABLE IF NOT EXISTS redirects (
+    id TEXT PRIMARY KEY,
+    fromURL TEXT,
+    fromDomain TEXT,
+    toURL TEXT,
+    updatedAt date
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS sync_state (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    lastSyncTime date,
+    watermark TEXT,
+    ruleSetVersion INTEGER,
+    ruleCount INTEGER
+);
@@ -0,0 +1,32 @@
+-- Redirects from every rule source are stored, ids are only unique within a source
+CREATE TABLE redirects_by_source (
+    source TEXT NOT NULL DEFAULT 'central',
+    id TEXT NOT NULL,
+    fromURL TEXT,
+    fromDomain TEXT,
+    toURL TEXT,
+    updatedAt date,
+    PRIMARY KEY (source, id)
+);
+INSERT INTO redirects_by_source (source, id, fromURL, fromDomain, toURL, updatedAt)
+SELECT 'central', id, fromURL, fromDomain, toURL, updatedAt FROM redirects;
+DROP TABLE redirects;
+ALTER TABLE redirects_by_source RENAME TO redirects;
+
+-- Every rule source resumes from its own watermark
+CREATE TABLE source_watermarks (
+    source TEXT PRIMARY KEY,
+    watermark TEXT
+);
+INSERT INTO source_watermarks (source, watermark)
+SELECT 'central', watermark FROM sync_state WHERE watermark IS NOT NULL AND watermark != '';
+ALTER TABLE sync_state DROP COLUMN watermark;
+
+-- Local overrides take precedence over the redirects of the Central API
+CREATE TABLE local_redirects (
+    id TEXT PRIMARY KEY,
+    fromURL TEXT,
+    fromDomain TEXT,
+    toURL TEXT,
+    updatedAt date
+);
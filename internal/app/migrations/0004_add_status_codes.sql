@@ -0,0 +1,3 @@
+-- Imported redirects keep their status code, 0 is the default 302
+ALTER TABLE redirects ADD COLUMN statusCode INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE local_redirects ADD COLUMN statusCode INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Hits of the indexed rules by id, unreportedHits are the ones not uploaded to the Central API yet
+CREATE TABLE rule_hits (
+    ruleId TEXT PRIMARY KEY,
+    hits INTEGER NOT NULL DEFAULT 0,
+    unreportedHits INTEGER NOT NULL DEFAULT 0,
+    firstHit date,
+    lastHit date
+);
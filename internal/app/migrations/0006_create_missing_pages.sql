@@ -0,0 +1,19 @@
+-- URLs the upstream answered with an error status, reported by the plugin as candidates for new redirects
+CREATE TABLE missing_pages (
+    url TEXT NOT NULL,
+    statusCode INTEGER NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    unreportedHits INTEGER NOT NULL DEFAULT 0,
+    firstSeen date,
+    lastSeen date,
+    PRIMARY KEY (url, statusCode)
+);
+
+-- The pages linking to a missing page, counted per referrer
+CREATE TABLE missing_page_referrers (
+    url TEXT NOT NULL,
+    statusCode INTEGER NOT NULL,
+    referrer TEXT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url, statusCode, referrer)
+);
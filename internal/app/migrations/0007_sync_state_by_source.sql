@@ -0,0 +1,17 @@
+-- The sync state is kept per rule source, so the sync of one source doesn't overwrite the position of another
+CREATE TABLE source_sync_state (
+    source TEXT PRIMARY KEY,
+    lastSyncTime date,
+    watermark TEXT NOT NULL DEFAULT '',
+    ruleSetVersion INTEGER NOT NULL DEFAULT 0,
+    ruleCount INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO source_sync_state (source, lastSyncTime, watermark, ruleSetVersion, ruleCount)
+SELECT sources.source, state.lastSyncTime, COALESCE(w.watermark, ''), COALESCE(state.ruleSetVersion, 0),
+       (SELECT COUNT(*) FROM redirects r WHERE r.source = sources.source)
+FROM (SELECT source FROM source_watermarks UNION SELECT source FROM redirects) sources
+LEFT JOIN source_watermarks w ON w.source = sources.source
+LEFT JOIN sync_state state ON state.id = 1;
+DROP TABLE source_watermarks;
+DROP TABLE sync_state;
+ALTER TABLE source_sync_state RENAME TO sync_state;
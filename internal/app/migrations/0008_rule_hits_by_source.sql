@@ -0,0 +1,14 @@
+-- Hits are kept per source, as the ids of the rules are only unique within a source
+CREATE TABLE rule_hits_by_source (
+    source TEXT NOT NULL DEFAULT 'central',
+    ruleId TEXT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    unreportedHits INTEGER NOT NULL DEFAULT 0,
+    firstHit date,
+    lastHit date,
+    PRIMARY KEY (source, ruleId)
+);
+INSERT INTO rule_hits_by_source (source, ruleId, hits, unreportedHits, firstHit, lastHit)
+SELECT 'central', ruleId, hits, unreportedHits, firstHit, lastHit FROM rule_hits;
+DROP TABLE rule_hits;
+ALTER TABLE rule_hits_by_source RENAME TO rule_hits;
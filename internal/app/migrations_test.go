@@ -0,0 +1,110 @@
+package app
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openV0Database creates a database file the way the app did before the migrations existed
+func openV0Database(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS redirects (
+		    id TEXT PRIMARY KEY,
+		    fromURL TEXT,
+		    fromDomain TEXT,
+		    toURL TEXT,
+		    updatedAt date
+		);
+		INSERT INTO redirects (id, fromURL, fromDomain, toURL, updatedAt)
+		VALUES ('1', '/school/assignments', '', '/school/items', '2024-06-01 12:00:00+00:00');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create v0 database: %v", err)
+	}
+
+	return db
+}
+
+func TestMigrate_UpgradesV0Database(t *testing.T) {
+	db := openV0Database(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	latest := migrations[len(migrations)-1].version
+
+	// Migrating twice has to be a no-op the second time
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+	if version != latest {
+		t.Errorf("unexpected schema version: got %v want %v", version, latest)
+	}
+
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatalf("Failed to count applied migrations: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("unexpected number of applied migrations: got %v want %v", applied, len(migrations))
+	}
+
+	rm := NewRedirectManager(db, []RuleSource{NewCentralSource(nil)}, 0, DeletionThreshold{})
+	rm.PopulateMapsWithDataFromDB()
+	if redirectURL, ok := rm.IndexedRedirects.Match("/school/assignments"); !ok || redirectURL != "/school/items" {
+		t.Errorf("v0 redirect lost during the migration: got %v want %v", redirectURL, "/school/items")
+	}
+
+	states, err := LoadSyncState(db)
+	if err != nil {
+		t.Errorf("sync_state table not usable after the migration: %v", err)
+	}
+	if state := states[CentralSourceName]; state.RuleCount != 1 {
+		t.Errorf("unexpected sync state of the v0 redirects: %+v", state)
+	}
+}
+
+func TestMigrate_FailsOnDowngrade(t *testing.T) {
+	db := openV0Database(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Pretend a newer version of the app migrated the database
+	if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (9999)"); err != nil {
+		t.Fatalf("Failed to insert schema version: %v", err)
+	}
+
+	if err := Migrate(db); err == nil {
+		t.Errorf("expected the migration to fail on a downgrade")
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	db := openV0Database(t)
+	if err := CheckSchemaVersion(db); err == nil {
+		t.Errorf("expected the check to fail before the migrations")
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	if err := CheckSchemaVersion(db); err != nil {
+		t.Errorf("unexpected error after the migrations: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"github.com/robfig/cron/v3"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxMissingPageURL leaves out the URLs and referrers longer than browsers and search engines handle
+	maxMissingPageURL = 2048
+	// maxReferrers is the number of referrers uploaded per missing page, the ones with the most hits
+	maxReferrers = 10
+	// missingPagesUploadSize is the number of missing pages uploaded per mutation
+	missingPagesUploadSize = 500
+)
+
+// MissingPage is a URL the upstream answered with an error status, as reported by the plugin in batches
+type MissingPage struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"statusCode"`
+	Referrer   string    `json:"referrer,omitempty"`
+	Count      int64     `json:"count"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// StoredMissingPage aggregates the reports of a URL and status code, with its referrers ordered by their hits
+type StoredMissingPage struct {
+	URL        string
+	StatusCode int
+	Hits       int64
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Referrers  []api.ReferrerInput
+	// Unreported are the hits not uploaded to the Central API yet
+	Unreported int64
+}
+
+// MissingPages keeps the missing pages reported by the plugin until they are uploaded as candidates for new redirects
+type MissingPages struct {
+	db *sql.DB
+}
+
+func NewMissingPages(db *sql.DB) *MissingPages {
+	return &MissingPages{db: db}
+}
+
+// validateMissingPage checks a reported page, and defaults its count and when it was last seen
+func validateMissingPage(page *MissingPage) error {
+	switch {
+	case page.URL == "":
+		return fmt.Errorf("missing url")
+	case len(page.URL) > maxMissingPageURL || len(page.Referrer) > maxMissingPageURL:
+		return fmt.Errorf("url or referrer longer than %d characters", maxMissingPageURL)
+	case page.StatusCode < 400 || page.StatusCode > 599:
+		return fmt.Errorf("status code %d of %s isn't an error", page.StatusCode, page.URL)
+	case page.Count < 0:
+		return fmt.Errorf("negative count of %s", page.URL)
+	}
+
+	if page.Count == 0 {
+		page.Count = 1
+	}
+	if page.LastSeen.IsZero() {
+		page.LastSeen = time.Now()
+	}
+	// Stored in UTC seconds so the timestamps compare as text
+	page.LastSeen = page.LastSeen.UTC().Truncate(time.Second)
+
+	return nil
+}
+
+// Record adds a batch of reported pages in a single transaction, nothing is recorded when any of them is invalid
+func (mp *MissingPages) Record(pages []MissingPage) error {
+	for i := range pages {
+		if err := validateMissingPage(&pages[i]); err != nil {
+			return fmt.Errorf("invalid missing page %d: %v", i+1, err)
+		}
+	}
+
+	tx, err := mp.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting the transaction: %v", err)
+	}
+
+	pageStmt := `
+		INSERT INTO missing_pages (url, statusCode, hits, unreportedHits, firstSeen, lastSeen)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(url, statusCode) DO UPDATE
+		SET hits = hits + EXCLUDED.hits, unreportedHits = unreportedHits + EXCLUDED.unreportedHits,
+		    firstSeen = MIN(firstSeen, EXCLUDED.firstSeen), lastSeen = MAX(lastSeen, EXCLUDED.lastSeen);
+		`
+	referrerStmt := `
+		INSERT INTO missing_page_referrers (url, statusCode, referrer, hits)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(url, statusCode, referrer) DO UPDATE SET hits = hits + EXCLUDED.hits;
+		`
+	for _, page := range pages {
+		if _, err := tx.Exec(pageStmt, page.URL, page.StatusCode, page.Count, page.Count, page.LastSeen, page.LastSeen); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error storing missing page %s: %v", page.URL, err)
+		}
+		if page.Referrer == "" {
+			continue
+		}
+		if _, err := tx.Exec(referrerStmt, page.URL, page.StatusCode, page.Referrer, page.Count); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error storing the referrer of missing page %s: %v", page.URL, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		missingPages.Add(float64(page.Count), strconv.Itoa(page.StatusCode))
+	}
+
+	return nil
+}
+
+// Stored returns up to the limit of stored missing pages with the most hits, only the ones with hits not uploaded yet when unreported is set
+func (mp *MissingPages) Stored(unreported bool, limit int) ([]StoredMissingPage, error) {
+	query := "SELECT url, statusCode, hits, firstSeen, lastSeen, unreportedHits FROM missing_pages"
+	if unreported {
+		query += " WHERE unreportedHits > 0"
+	}
+
+	rows, err := mp.db.Query(query+" ORDER BY hits DESC, url, statusCode LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the missing pages: %v", err)
+	}
+
+	var stored []StoredMissingPage
+	for rows.Next() {
+		var page StoredMissingPage
+		if err := rows.Scan(&page.URL, &page.StatusCode, &page.Hits, &page.FirstSeen, &page.LastSeen, &page.Unreported); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("error scanning the missing pages: %v", err)
+		}
+		stored = append(stored, page)
+	}
+	if err := rows.Close(); err != nil {
+		log.Println("Error closing rows:", err)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range stored {
+		if stored[i].Referrers, err = mp.referrers(stored[i].URL, stored[i].StatusCode); err != nil {
+			return nil, err
+		}
+	}
+
+	return stored, nil
+}
+
+// referrers returns the maxReferrers referrers of a missing page with the most hits
+func (mp *MissingPages) referrers(url string, statusCode int) ([]api.ReferrerInput, error) {
+	rows, err := mp.db.Query(
+		"SELECT referrer, hits FROM missing_page_referrers WHERE url = ? AND statusCode = ? ORDER BY hits DESC, referrer LIMIT ?",
+		url, statusCode, maxReferrers,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the referrers of %s: %v", url, err)
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("Error closing rows:", err)
+		}
+	}()
+
+	referrers := make([]api.ReferrerInput, 0)
+	for rows.Next() {
+		var referrer api.ReferrerInput
+		if err := rows.Scan(&referrer.Referrer, &referrer.Hits); err != nil {
+			return nil, fmt.Errorf("error scanning the referrers of %s: %v", url, err)
+		}
+		referrers = append(referrers, referrer)
+	}
+
+	return referrers, rows.Err()
+}
+
+// markReported subtracts the uploaded hits from the unreported ones, the hits recorded in the meantime stay unreported
+func (mp *MissingPages) markReported(reported []StoredMissingPage) error {
+	tx, err := mp.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting the transaction: %v", err)
+	}
+
+	for _, page := range reported {
+		_, err := tx.Exec("UPDATE missing_pages SET unreportedHits = unreportedHits - ? WHERE url = ? AND statusCode = ?",
+			page.Unreported, page.URL, page.StatusCode)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error marking missing page %s as reported: %v", page.URL, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReportWeekly starts a cron job to upload the missing pages weekly
+func (mp *MissingPages) ReportWeekly(gqlClient *api.GraphQLClient) {
+	c := cron.New()
+	_, err := c.AddFunc("@weekly", func() {
+		if err := mp.Report(gqlClient); err != nil {
+			log.Println("Error reporting the missing pages:", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Error scheduling cron job: %v", err)
+	}
+	c.Start()
+}
+
+// Report uploads the totals of the missing pages seen since the last upload, in parts of missingPagesUploadSize pages
+func (mp *MissingPages) Report(gqlClient *api.GraphQLClient) error {
+	// Pages seen again while uploading are left for the next upload
+	var pending int
+	if err := mp.db.QueryRow("SELECT COUNT(*) FROM missing_pages WHERE unreportedHits > 0").Scan(&pending); err != nil {
+		return fmt.Errorf("error counting the missing pages: %v", err)
+	}
+
+	reported := 0
+	for reported < pending {
+		unreported, err := mp.Stored(true, missingPagesUploadSize)
+		if err != nil {
+			return err
+		}
+		if len(unreported) == 0 {
+			break
+		}
+
+		input := make([]api.MissingPageInput, 0, len(unreported))
+		for _, page := range unreported {
+			input = append(input, api.MissingPageInput{
+				URL:        page.URL,
+				StatusCode: page.StatusCode,
+				Hits:       page.Hits,
+				FirstSeen:  page.FirstSeen,
+				LastSeen:   page.LastSeen,
+				Referrers:  page.Referrers,
+			})
+		}
+
+		response, err := gqlClient.ExecuteMissingPagesMutation(input)
+		if err != nil {
+			return err
+		}
+		if !response.Success {
+			return fmt.Errorf("missing pages rejected: %s", response.Message)
+		}
+		if err := mp.markReported(unreported); err != nil {
+			return err
+		}
+		reported += len(unreported)
+	}
+
+	log.Printf("Reported %d missing pages\n", reported)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMissingPages_Record(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	mp := NewMissingPages(db)
+
+	seen := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := mp.Record([]MissingPage{
+		{URL: "https://example.com/old", StatusCode: 404, Referrer: "https://blog.com/post", Count: 3, LastSeen: seen},
+		{URL: "https://example.com/old", StatusCode: 404, Count: 1, LastSeen: seen.Add(time.Hour)},
+		{URL: "https://example.com/gone", StatusCode: 410},
+	}); err != nil {
+		t.Fatalf("Failed to record missing pages: %v", err)
+	}
+	if err := mp.Record([]MissingPage{
+		{URL: "https://example.com/old", StatusCode: 404, Referrer: "https://news.com", Count: 5, LastSeen: seen.Add(-time.Hour)},
+	}); err != nil {
+		t.Fatalf("Failed to record missing pages: %v", err)
+	}
+
+	// A batch with an invalid page isn't recorded at all
+	if err := mp.Record([]MissingPage{{URL: "https://example.com/old", StatusCode: 404}, {URL: "https://example.com/ok", StatusCode: 200}}); err == nil {
+		t.Errorf("expected an error for a page that isn't missing")
+	}
+
+	stored, err := mp.Stored(true, 10)
+	if err != nil {
+		t.Fatalf("Failed to read missing pages: %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("unexpected missing pages: %+v", stored)
+	}
+	old := stored[0]
+	if old.URL != "https://example.com/old" || old.Hits != 9 || old.Unreported != 9 ||
+		!old.FirstSeen.Equal(seen.Add(-time.Hour)) || !old.LastSeen.Equal(seen.Add(time.Hour)) {
+		t.Errorf("unexpected missing page: %+v", old)
+	}
+	if len(old.Referrers) != 2 || old.Referrers[0].Referrer != "https://news.com" || old.Referrers[0].Hits != 5 || old.Referrers[1].Hits != 3 {
+		t.Errorf("unexpected referrers: %+v", old.Referrers)
+	}
+	if gone := stored[1]; gone.StatusCode != 410 || gone.Hits != 1 || len(gone.Referrers) != 0 {
+		t.Errorf("unexpected missing page: %+v", gone)
+	}
+
+	if err := mp.markReported(stored[:1]); err != nil {
+		t.Fatalf("Failed to mark missing pages as reported: %v", err)
+	}
+	if unreported, _ := mp.Stored(true, 10); len(unreported) != 1 || unreported[0].URL != "https://example.com/gone" {
+		t.Errorf("unexpected unreported missing pages: %+v", unreported)
+	}
+}
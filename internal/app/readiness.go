@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"time"
+)
+
+// readinessTimeout bounds the database query of a readiness check
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck is the outcome of one of the conditions for serving redirects
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness tells whether the app can serve redirects, it is ready when all its checks are
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+/*
+Readiness checks whether the redirects can be served:
+  - rules: the stored redirects are loaded, and a sync succeeded or a synced rule set was stored before
+  - database: the sqlite file can be queried
+  - token: the access token for the Central API obtained by the syncs is still valid, skipped without a GraphQL client
+  - sync: the latest successful sync of the central source, or else the oldest one of the sources, isn't older
+    than the max staleness, skipped when it is zero
+*/
+func (rm *RedirectManager) Readiness(graphqlClient *api.GraphQLClient, maxStaleness time.Duration) Readiness {
+	rm.mu.RLock()
+	loaded := rm.loaded
+	rm.mu.RUnlock()
+	status := rm.Status()
+
+	var checks []ReadinessCheck
+	check := func(name string, err error) {
+		result := ReadinessCheck{Name: name, Ready: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		checks = append(checks, result)
+	}
+
+	switch {
+	case !loaded:
+		check("rules", fmt.Errorf("the stored redirects aren't loaded"))
+	case status.lastSuccess().IsZero() && status.RuleCount == 0:
+		check("rules", fmt.Errorf("no sync succeeded yet and no rule set is stored"))
+	default:
+		check("rules", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+	var one int
+	if err := rm.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		check("database", fmt.Errorf("error querying the database: %v", err))
+	} else {
+		check("database", nil)
+	}
+
+	if graphqlClient != nil {
+		// The token isn't requested here, a request holds the client until the Central API answers
+		if err := graphqlClient.CheckCachedToken(); err != nil {
+			check("token", err)
+		} else {
+			check("token", nil)
+		}
+	}
+
+	if lastSuccess := status.staleSuccess(); maxStaleness > 0 && !lastSuccess.IsZero() {
+		if age := time.Since(lastSuccess); age > maxStaleness {
+			check("sync", fmt.Errorf("the latest successful sync is %s old, more than %s", age.Round(time.Second), maxStaleness))
+		} else {
+			check("sync", nil)
+		}
+	}
+
+	readiness := Readiness{Ready: true, Checks: checks}
+	for _, result := range checks {
+		readiness.Ready = readiness.Ready && result.Ready
+	}
+
+	return readiness
+}
+
+// lastSuccess returns the latest successful sync of any source
+func (s SyncStatus) lastSuccess() time.Time {
+	var latest time.Time
+	for _, source := range s.Sources {
+		if source.LastSuccess.After(latest) {
+			latest = source.LastSuccess
+		}
+	}
+
+	return latest
+}
+
+/*
+staleSuccess returns the successful sync the staleness is judged by. The other sources are read locally and
+keep syncing while the Central API fails, so it is the central source when there is one, or else the oldest sync.
+*/
+func (s SyncStatus) staleSuccess() time.Time {
+	if central, ok := s.Sources[CentralSourceName]; ok {
+		return central.LastSuccess
+	}
+
+	var oldest time.Time
+	for _, source := range s.Sources {
+		if !source.LastSuccess.IsZero() && (oldest.IsZero() || source.LastSuccess.Before(oldest)) {
+			oldest = source.LastSuccess
+		}
+	}
+
+	return oldest
+}
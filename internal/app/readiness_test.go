@@ -0,0 +1,75 @@
+package app
+
+import (
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectManager_Readiness(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	rm := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db)}, time.Hour, DeletionThreshold{})
+
+	failing := func(readiness Readiness) []string {
+		var names []string
+		for _, check := range readiness.Checks {
+			if !check.Ready {
+				names = append(names, check.Name)
+			}
+		}
+		return names
+	}
+
+	if readiness := rm.Readiness(nil, time.Hour); readiness.Ready || len(failing(readiness)) != 1 || failing(readiness)[0] != "rules" {
+		t.Errorf("ready before loading the stored redirects: %+v", readiness)
+	}
+
+	// Nothing is stored yet, a sync has to succeed first
+	rm.PopulateMapsWithDataFromDB()
+	if readiness := rm.Readiness(nil, time.Hour); readiness.Ready {
+		t.Errorf("ready without a rule set: %+v", readiness)
+	}
+
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source:    LocalSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "^/about$", ToURL: "/company/about"}},
+		Full:      true,
+	}); err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if readiness := rm.Readiness(nil, time.Hour); !readiness.Ready || len(readiness.Checks) != 3 {
+		t.Errorf("not ready after a sync: %+v", readiness)
+	}
+
+	rm.mu.Lock()
+	rm.sources[0].status.LastSuccess = time.Now().Add(-2 * time.Hour)
+	rm.mu.Unlock()
+	if readiness := rm.Readiness(nil, time.Hour); readiness.Ready || failing(readiness)[0] != "sync" {
+		t.Errorf("ready with a stale sync: %+v", readiness)
+	}
+	if readiness := rm.Readiness(nil, 0); !readiness.Ready {
+		t.Errorf("not ready without a max staleness: %+v", readiness)
+	}
+
+	// Only the central source is judged, the local one keeps syncing while the Central API fails
+	rm.sources = append(rm.sources, newRuleSet(NewCentralSource(nil)))
+	rm.sources[0].status.LastSuccess = time.Now()
+	rm.sources[1].status.LastSuccess = time.Now().Add(-2 * time.Hour)
+	if readiness := rm.Readiness(nil, time.Hour); readiness.Ready || failing(readiness)[0] != "sync" {
+		t.Errorf("ready with a stale central sync: %+v", readiness)
+	}
+
+	_ = db.Close()
+	if readiness := rm.Readiness(nil, 0); readiness.Ready || failing(readiness)[0] != "database" {
+		t.Errorf("ready without a database: %+v", readiness)
+	}
+}
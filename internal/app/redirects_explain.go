@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MatchTrace explains how a request is matched, with the lookups in the order the plugin does them
+type MatchTrace struct {
+	URL     string        `json:"url"`
+	Lookups []LookupTrace `json:"lookups"`
+	Matched bool          `json:"matched"`
+	// RuleId, Target and StatusCode describe the rule that won, with the target rendered from its capture groups
+	RuleId     string `json:"ruleId,omitempty"`
+	Target     string `json:"target,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+// LookupTrace is a lookup of a full URL in the domain rules, or of a path in its bucket of the LengthMap
+type LookupTrace struct {
+	Request string `json:"request"`
+	// Bucket is domain or path, the bucket of a path is selected by its number of segments and first segment
+	Bucket     string           `json:"bucket"`
+	Segments   int              `json:"segments,omitempty"`
+	Prefix     string           `json:"prefix,omitempty"`
+	Candidates []CandidateTrace `json:"candidates"`
+}
+
+// CandidateTrace is a rule tried by a lookup, with its capture groups if it matched
+type CandidateTrace struct {
+	RuleId   string   `json:"ruleId,omitempty"`
+	Pattern  string   `json:"pattern"`
+	Target   string   `json:"target"`
+	Matched  bool     `json:"matched"`
+	Captures []string `json:"captures,omitempty"`
+}
+
+/*
+Explain traces the matching of a URL the way the plugin does it, without counting a hit. A full URL is lowercased
+and looked up in the domain rules first, then its path is looked up in the path rules. The query string is ignored.
+*/
+func (idx *IndexedRedirects) Explain(rawURL string) (MatchTrace, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return MatchTrace{}, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	var requests []string
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		requests = append(requests, strings.ToLower(u.Scheme+"://"+u.Host+u.Path))
+	case u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/"):
+		return MatchTrace{}, fmt.Errorf("expected a path or an http(s) URL, got %q", rawURL)
+	}
+	requests = append(requests, u.Path)
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	trace := MatchTrace{URL: rawURL}
+	for _, request := range requests {
+		lookup := LookupTrace{Request: request, Bucket: "domain", Candidates: []CandidateTrace{}}
+		if !strings.HasPrefix(request, "http://") && !strings.HasPrefix(request, "https://") {
+			lookup.Bucket = "path"
+			lookup.Segments, lookup.Prefix = pathBucket(request)
+		}
+
+		for _, rule := range idx.candidates(request) {
+			candidate := CandidateTrace{RuleId: rule.id, Pattern: rule.pattern.String(), Target: rule.target}
+			if rule.isDomain {
+				candidate.Pattern = rule.fromDomain.String()
+			}
+
+			matches := rule.match(request)
+			if matches != nil {
+				candidate.Matched, candidate.Captures = true, matches[1:]
+				trace.Matched, trace.RuleId = true, rule.id
+				trace.Target, trace.StatusCode = rule.render(matches), redirectStatusCode(rule.statusCode)
+			}
+			lookup.Candidates = append(lookup.Candidates, candidate)
+			if matches != nil {
+				break
+			}
+		}
+
+		trace.Lookups = append(trace.Lookups, lookup)
+		if trace.Matched {
+			break
+		}
+	}
+
+	return trace, nil
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"testing"
+)
+
+func TestIndexedRedirects_Explain(t *testing.T) {
+	idx := NewIndexedRedirects()
+	idx.IndexRedirect(api.Redirect{Id: "domain", FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1", StatusCode: 301})
+	idx.IndexRedirect(api.Redirect{Id: "sales", FromURL: "^/careers/sales$", ToURL: "/jobs/sales"})
+	idx.IndexRedirect(api.Redirect{Id: "careers", FromURL: "^/careers/(.*)$", ToURL: "/jobs/$1"})
+
+	trace, err := idx.Explain("https://Example.com/careers/Engineer?ref=mail")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !trace.Matched || trace.RuleId != "careers" || trace.Target != "/jobs/Engineer" || trace.StatusCode != 302 {
+		t.Errorf("unexpected winner: %+v", trace)
+	}
+	if len(trace.Lookups) != 2 {
+		t.Fatalf("unexpected lookups: %+v", trace.Lookups)
+	}
+	if domain := trace.Lookups[0]; domain.Request != "https://example.com/careers/engineer" || domain.Bucket != "domain" || len(domain.Candidates) != 1 || domain.Candidates[0].Matched {
+		t.Errorf("unexpected domain lookup: %+v", domain)
+	}
+	path := trace.Lookups[1]
+	if path.Request != "/careers/Engineer" || path.Bucket != "path" || path.Segments != 3 || path.Prefix != "careers" || len(path.Candidates) != 2 {
+		t.Fatalf("unexpected path lookup: %+v", path)
+	}
+	if candidate := path.Candidates[1]; !candidate.Matched || len(candidate.Captures) != 1 || candidate.Captures[0] != "Engineer" {
+		t.Errorf("unexpected candidate: %+v", candidate)
+	}
+
+	// A domain match ends the trace, like in the plugin
+	if trace, _ := idx.Explain("https://old-domain.com/about"); len(trace.Lookups) != 1 || trace.RuleId != "domain" || trace.StatusCode != 301 {
+		t.Errorf("unexpected trace: %+v", trace)
+	}
+	if trace, _ := idx.Explain("/nothing"); trace.Matched || len(trace.Lookups) != 1 || len(trace.Lookups[0].Candidates) != 0 {
+		t.Errorf("unexpected trace: %+v", trace)
+	}
+	if _, err := idx.Explain("mailto:support@example.com"); err == nil {
+		t.Errorf("expected an error for a mailto URL")
+	}
+
+	// Explaining doesn't count as a hit
+	if hits := idx.unflushedHits("", "careers"); hits != 0 {
+		t.Errorf("unexpected hits: got %d want 0", hits)
+	}
+}
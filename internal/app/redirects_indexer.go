@@ -2,9 +2,11 @@ package app
 
 import (
 	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Rule struct {
@@ -12,94 +14,151 @@ type Rule struct {
 	target     string
 	fromDomain *regexp.Regexp
 	isDomain   bool
+	// counter counts the matches of the rule by its source and id, it is nil for the rules indexed without an id
+	counter *ruleCounter
+	// id and statusCode are only known for the redirects indexed with IndexRedirect
+	id         string
+	statusCode int
 }
 
 type IndexedRedirects struct {
 	LengthMap   map[int]map[string][]*Rule
 	DomainRules []*Rule
-	mu          sync.RWMutex
+	// counters count the matches by the source and id of a rule until they are stored, kept when a rule is indexed again
+	counters map[ruleHitsKey]*ruleCounter
+	// retired are the counters of removed rules, their hits are stored once more before they are dropped
+	retired map[ruleHitsKey]*ruleCounter
+	mu      sync.RWMutex
 }
 
 func NewIndexedRedirects() *IndexedRedirects {
 	return &IndexedRedirects{
 		LengthMap:   make(map[int]map[string][]*Rule),
 		DomainRules: []*Rule{},
+		counters:    make(map[ruleHitsKey]*ruleCounter),
+		retired:     make(map[ruleHitsKey]*ruleCounter),
 	}
 }
 
 func (idx *IndexedRedirects) IndexRule(pattern, fromDomain, target string) {
+	idx.IndexRedirect(api.Redirect{FromURL: pattern, FromDomain: fromDomain, ToURL: target})
+}
+
+// IndexRedirect indexes a redirect along with its id and status code, which are reported when explaining a match
+func (idx *IndexedRedirects) IndexRedirect(r api.Redirect) {
+	idx.indexRedirect("", r)
+}
+
+// indexRedirect indexes a redirect of the source, its hits are counted by the source and id
+func (idx *IndexedRedirects) indexRedirect(source string, r api.Redirect) {
 	rule := &Rule{
-		pattern:    regexp.MustCompile(pattern),
-		target:     target,
-		fromDomain: regexp.MustCompile(fromDomain),
-		isDomain:   fromDomain != "",
+		pattern:    regexp.MustCompile(r.FromURL),
+		target:     r.ToURL,
+		fromDomain: regexp.MustCompile(r.FromDomain),
+		isDomain:   r.FromDomain != "",
+		id:         r.Id,
+		statusCode: r.StatusCode,
 	}
 
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	if r.Id != "" {
+		key := ruleHitsKey{Source: source, RuleId: r.Id}
+		if idx.counters[key] == nil {
+			idx.counters[key] = &ruleCounter{}
+		}
+		rule.counter = idx.counters[key]
+	}
+
 	if rule.isDomain {
 		idx.DomainRules = append(idx.DomainRules, rule)
 	} else {
-		length := len(strings.Split(pattern, "/"))
+		length := len(strings.Split(r.FromURL, "/"))
 		if _, ok := idx.LengthMap[length]; !ok {
 			idx.LengthMap[length] = make(map[string][]*Rule)
 		}
-		prefix := getPrefix(pattern)
+		prefix := getPrefix(r.FromURL)
 		idx.LengthMap[length][prefix] = append(idx.LengthMap[length][prefix], rule)
 	}
 }
 
 // Match matches the incoming requests against the redirect rules
 func (idx *IndexedRedirects) Match(url string) (string, bool) {
-	isFullURL := strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+	redirectURL, _, ok := idx.MatchRedirect(url)
+	return redirectURL, ok
+}
+
+// MatchRedirect matches a request like Match, along with the status code of the redirect
+func (idx *IndexedRedirects) MatchRedirect(url string) (string, int, bool) {
+	rule, matches := idx.lookup(url)
+	if rule == nil {
+		matchRequests.Inc(MatchMiss)
+		return "", 0, false
+	}
+
+	if rule.isDomain {
+		matchRequests.Inc(MatchDomain)
+	} else {
+		matchRequests.Inc(MatchPath)
+	}
+	if rule.counter != nil {
+		rule.counter.add(time.Now())
+	}
+	return rule.render(matches), redirectStatusCode(rule.statusCode), true
+}
 
+// lookup returns the first rule matching the request and its capture groups, without counting a hit
+func (idx *IndexedRedirects) lookup(url string) (*Rule, []string) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	if isFullURL {
-		return idx.matchDomain(url)
+	for _, rule := range idx.candidates(url) {
+		if matches := rule.match(url); matches != nil {
+			return rule, matches
+		}
 	}
 
-	return idx.matchRelativePath(url)
+	return nil, nil
 }
 
-func (idx *IndexedRedirects) matchDomain(url string) (string, bool) {
-	for _, rule := range idx.DomainRules {
-		if matches := rule.fromDomain.FindStringSubmatch(url); matches != nil {
-			redirectURL := rule.target
-			for i := 1; i < len(matches); i++ {
-				placeholder := fmt.Sprintf("$%d", i)
-				redirectURL = strings.ReplaceAll(redirectURL, placeholder, matches[i])
-			}
-			return redirectURL, true
-		}
+// candidates returns the rules a request is matched against, the domain rules for a full URL or else the bucket of the path
+func (idx *IndexedRedirects) candidates(url string) []*Rule {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return idx.DomainRules
 	}
 
-	return "", false
+	length, prefix := pathBucket(url)
+	return idx.LengthMap[length][prefix]
 }
 
-func (idx *IndexedRedirects) matchRelativePath(url string) (string, bool) {
+// pathBucket returns the number of segments and the first segment of a path, which select the rules of its LengthMap bucket
+func pathBucket(url string) (int, string) {
 	urlParts := strings.Split(url, "/")
-	length := len(urlParts)
-	prefix := urlParts[1]
-
-	if prefixes, ok := idx.LengthMap[length]; ok {
-		if rules, ok := prefixes[prefix]; ok {
-			for _, rule := range rules {
-				if matches := rule.pattern.FindStringSubmatch(url); matches != nil {
-					redirectURL := rule.target
-					for i := 1; i < len(matches); i++ {
-						placeholder := fmt.Sprintf("$%d", i)
-						redirectURL = strings.ReplaceAll(redirectURL, placeholder, matches[i])
-					}
-					return redirectURL, true
-				}
-			}
-		}
+	if len(urlParts) < 2 {
+		return len(urlParts), ""
+	}
+
+	return len(urlParts), urlParts[1]
+}
+
+func (rule *Rule) match(url string) []string {
+	if rule.isDomain {
+		return rule.fromDomain.FindStringSubmatch(url)
+	}
+
+	return rule.pattern.FindStringSubmatch(url)
+}
+
+// render replaces the $n placeholders of the target with the capture groups
+func (rule *Rule) render(matches []string) string {
+	redirectURL := rule.target
+	for i := 1; i < len(matches); i++ {
+		placeholder := fmt.Sprintf("$%d", i)
+		redirectURL = strings.ReplaceAll(redirectURL, placeholder, matches[i])
 	}
 
-	return "", false
+	return redirectURL
 }
 
 func (idx *IndexedRedirects) Update(pattern, fromDomain, target string) {
@@ -168,7 +227,8 @@ func getPrefix(pattern string) string {
 	if pattern != "^/$" {
 		patternParts := strings.Split(pattern, "/")
 		if len(patternParts) > 1 {
-			prefix = patternParts[1]
+			// An anchored single segment pattern like ^/about$ has the same prefix as the request
+			prefix = strings.TrimSuffix(patternParts[1], "$")
 		}
 	}
 	return prefix
@@ -8,6 +8,7 @@ func TestIndexedRedirects_Index_And_Match(t *testing.T) {
 	idx.IndexRule("", "old-domain.com$", "https://new-domain.com/welcome")
 	idx.IndexRule("/home/company/careers/(.*)", "", "/careers/$1")
 	idx.IndexRule("", "example.com/(.*)", "https://new-example.com/$1")
+	idx.IndexRule("^/about$", "", "/company/about")
 
 	testCases := []struct {
 		name             string
@@ -29,6 +30,11 @@ func TestIndexedRedirects_Index_And_Match(t *testing.T) {
 			request:          "/home/company/careers/software-engineer-hengelo",
 			expectedRedirect: "/careers/software-engineer-hengelo",
 		},
+		{
+			name:             "Anchored single segment redirect",
+			request:          "/about",
+			expectedRedirect: "/company/about",
+		},
 		{
 			name:             "Captured group domain redirect",
 			request:          "https://example.com/hello",
@@ -1,73 +1,212 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"math/rand/v2"
+	"sync"
 	"time"
 )
 
+// retryBaseDelay is the first delay before retrying a failed sync, it doubles with every consecutive failure
+const retryBaseDelay = 5 * time.Second
+
+// SourceStatus describes the outcome of the latest sync of a rule source
+type SourceStatus struct {
+	LastAttempt time.Time `json:"lastAttempt"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastError   string    `json:"lastError,omitempty"`
+	Added       int       `json:"added"`
+	Updated     int       `json:"updated"`
+	Deleted     int       `json:"deleted"`
+	RuleCount   int       `json:"ruleCount"`
+	// PendingDeletions are held back by the deletion threshold until approved
+	PendingDeletions int `json:"pendingDeletions"`
+}
+
+// SyncStatus describes the rule sets of all sources, along with the outcome of the latest sync of every source
+type SyncStatus struct {
+	// RuleSetVersion increases with every sync that changed the redirects
+	RuleSetVersion int `json:"ruleSetVersion"`
+	RuleCount      int `json:"ruleCount"`
+	// PendingDeletions is the number of deletions held back of all sources
+	PendingDeletions int `json:"pendingDeletions"`
+	// Conflicts is the number of conflicts found between the indexed rules
+	Conflicts int                     `json:"conflicts"`
+	Sources   map[string]SourceStatus `json:"sources"`
+}
+
 type RedirectManager struct {
-	db               *sql.DB
-	gqlClient        *api.GraphQLClient
-	redirects        map[string]*api.Redirect
+	db *sql.DB
+	// sources are ordered by precedence, the first source wins
+	sources          []*ruleSet
 	IndexedRedirects *IndexedRedirects
-	lastSyncTime     time.Time
+	syncInterval     time.Duration
+	syncTrigger      chan struct{}
+	// analyzeTrigger requests an analysis of the conflicts, see AnalyzeConflictsOnChange
+	analyzeTrigger    chan struct{}
+	deletionThreshold DeletionThreshold
+	// status holds the totals of all sources, the status of every source is kept in its rule set
+	status    SyncStatus
+	conflicts ConflictReport
+	loaded    bool
+	mu        sync.RWMutex
+	// syncMu serializes the changes to the rule sets and the index
+	syncMu sync.Mutex
 }
 
-func NewRedirectManager(db *sql.DB, gqlClient *api.GraphQLClient) *RedirectManager {
-	return &RedirectManager{
-		db:               db,
-		gqlClient:        gqlClient,
-		redirects:        make(map[string]*api.Redirect),
-		IndexedRedirects: NewIndexedRedirects(),
-		lastSyncTime:     time.Time{},
+func NewRedirectManager(db *sql.DB, sources []RuleSource, syncInterval time.Duration, deletionThreshold DeletionThreshold) *RedirectManager {
+	rm := &RedirectManager{
+		db:                db,
+		IndexedRedirects:  NewIndexedRedirects(),
+		syncInterval:      syncInterval,
+		syncTrigger:       make(chan struct{}, 1),
+		analyzeTrigger:    make(chan struct{}, 1),
+		deletionThreshold: deletionThreshold,
 	}
+	for _, source := range sources {
+		rm.sources = append(rm.sources, newRuleSet(source))
+	}
+
+	return rm
 }
 
-func (rm *RedirectManager) FetchRedirectsOverChannel(redirectsCh chan<- []api.Redirect, errCh chan<- error) {
-	if len(rm.redirects) == 0 {
-		fetchedRedirects, err := rm.gqlClient.ExecuteRedirectsQuery()
-		if err != nil {
-			errCh <- err
+/*
+FetchRedirectsOverChannel fetches the changed redirects of every source each sync interval, or right away when a sync is triggered.
+Failed fetches are retried with a jittered exponential backoff, capped at the sync interval.
+*/
+func (rm *RedirectManager) FetchRedirectsOverChannel(redirectsCh chan<- api.RedirectChanges, errCh chan<- error) {
+	failures := 0
+	for {
+		delay := rm.syncInterval
+		if rm.fetchChanges(redirectsCh, errCh) {
+			failures = 0
 		} else {
-			redirectsCh <- fetchedRedirects
+			failures++
+			delay = retryDelay(failures, rm.syncInterval)
+			log.Printf("Retrying redirects sync in %s\n", delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-rm.syncTrigger:
 		}
 	}
+}
 
+/*
+SubscribeRedirects listens to the live redirect updates of a source as an alternative to waiting for the next poll.
+Every (re)connect triggers a sync, so the changes missed while disconnected are caught up through the watermark.
+*/
+func (rm *RedirectManager) SubscribeRedirects(source SubscribableSource, redirectsCh chan<- api.RedirectChanges, errCh chan<- error) {
+	failures := 0
 	for {
-		select {
-		case <-time.After(7 * 24 * time.Hour):
-			fetchedRedirects, err := rm.gqlClient.ExecuteRedirectsQuery()
-			if err != nil {
-				errCh <- err
-			} else {
-				redirectsCh <- fetchedRedirects
-			}
+		err := source.Subscribe(context.Background(), func() {
+			failures = 0
+			log.Println("Subscribed to live redirect updates of source:", source.Name())
+			rm.TriggerSync()
+		}, redirectsCh)
+
+		failures++
+		if err != nil {
+			errCh <- err
 		}
+
+		delay := retryDelay(failures, rm.syncInterval)
+		log.Printf("Reconnecting to live redirect updates in %s\n", delay)
+		time.Sleep(delay)
 	}
 }
 
-func (rm *RedirectManager) PopulateMapsWithDataFromDB() {
-	_, err := rm.db.Exec(`
-		CREATE TABLE IF NOT EXISTS redirects (
-		    id TEXT PRIMARY KEY,
-		    fromURL TEXT,
-		    fromDomain TEXT,
-		    toURL TEXT,
-		    updatedAt date
-		)
-	`)
-	if err != nil {
-		log.Println("Error creating redirects table:", err)
-		return
+// TriggerSync requests an immediate sync, it returns false if a sync was already pending
+func (rm *RedirectManager) TriggerSync() bool {
+	select {
+	case rm.syncTrigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// fetchChanges asks every source for everything that changed since its last applied watermark
+func (rm *RedirectManager) fetchChanges(redirectsCh chan<- api.RedirectChanges, errCh chan<- error) bool {
+	ok := true
+	for _, set := range rm.sources {
+		rm.mu.Lock()
+		set.status.LastAttempt = time.Now().UTC()
+		rm.mu.Unlock()
+
+		start := time.Now()
+		changes, err := set.source.FetchChanges(rm.Watermark(set.source.Name()))
+		syncDuration.ObserveSince(start, set.source.Name(), "fetch")
+		if err != nil {
+			syncErrors.Inc(set.source.Name())
+			err = fmt.Errorf("%s source: %v", set.source.Name(), err)
+			rm.mu.Lock()
+			set.status.LastError = err.Error()
+			rm.mu.Unlock()
+
+			errCh <- err
+			ok = false
+			continue
+		}
+
+		redirectsCh <- changes
+	}
+
+	return ok
+}
+
+// retryDelay returns a random delay between half and the full exponential backoff for the given number of failures
+func retryDelay(failures int, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if failures < 32 && retryBaseDelay<<(failures-1) < maxDelay {
+		delay = retryBaseDelay << (failures - 1)
 	}
 
-	rows, err := rm.db.Query("SELECT * FROM redirects")
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Status returns the totals of the rule sets and the outcome of the latest sync of every source
+func (rm *RedirectManager) Status() SyncStatus {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	status := rm.status
+	status.Sources = make(map[string]SourceStatus, len(rm.sources))
+	for _, set := range rm.sources {
+		status.Sources[set.source.Name()] = set.status
+		status.PendingDeletions += set.status.PendingDeletions
+	}
+
+	return status
+}
+
+// Watermark returns the watermark of the last change set applied from the source
+func (rm *RedirectManager) Watermark(source string) string {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	if set := rm.ruleSet(source); set != nil {
+		return set.watermark
+	}
+
+	return ""
+}
+
+// PopulateMapsWithDataFromDB loads the stored redirects, the database has to be migrated beforehand
+func (rm *RedirectManager) PopulateMapsWithDataFromDB() {
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+
+	rows, err := rm.db.Query("SELECT source, id, fromURL, fromDomain, toURL, updatedAt, statusCode FROM redirects")
 	if err != nil {
 		log.Println("Error retrieving SQL records:", err)
+		return
 	}
 
 	defer func() {
@@ -77,35 +216,66 @@ func (rm *RedirectManager) PopulateMapsWithDataFromDB() {
 		}
 	}()
 
+	plans := make(map[*ruleSet]*syncPlan)
 	for rows.Next() {
+		var source string
 		r := api.Redirect{}
-		err = rows.Scan(&r.Id, &r.FromURL, &r.FromDomain, &r.ToURL, &r.UpdatedAt)
+		err = rows.Scan(&source, &r.Id, &r.FromURL, &r.FromDomain, &r.ToURL, &r.UpdatedAt, &r.StatusCode)
 		if err != nil {
 			log.Println("Error scanning the SQL rows:", err)
+			continue
+		}
+
+		set := rm.ruleSet(source)
+		if set == nil {
+			log.Printf("Skipping redirect %s of the unconfigured %s source\n", r.Id, source)
+			continue
+		}
+		if plans[set] == nil {
+			plans[set] = &syncPlan{}
 		}
-		// Add to redirects map
-		rm.redirects[r.Id] = &r
-		// Add to IndexedRedirects
-		rm.IndexedRedirects.IndexRule(r.FromURL, r.FromDomain, r.ToURL)
+		plans[set].added = append(plans[set].added, r)
 	}
+
+	// Add to the rule sets and the IndexedRedirects, in precedence order
+	ruleCount := 0
+	for _, set := range rm.sources {
+		if plan, ok := plans[set]; ok {
+			rm.applySyncPlan(set, plan)
+			ruleCount += len(set.redirects)
+		}
+	}
+
+	// Resume the sync of every source from its persisted state
+	states, err := LoadSyncState(rm.db)
+	if err != nil {
+		log.Println("Error loading the sync state:", err)
+		return
+	}
+
+	rm.mu.Lock()
+	for _, set := range rm.sources {
+		state := states[set.source.Name()]
+		set.watermark = state.Watermark
+		set.status.LastSuccess = state.LastSyncTime
+		set.status.RuleCount = len(set.redirects)
+		rm.status.RuleSetVersion = max(rm.status.RuleSetVersion, state.RuleSetVersion)
+	}
+	rm.status.RuleCount = ruleCount
+	rm.loaded = true
+	rm.mu.Unlock()
+
+	rm.scheduleConflictAnalysis()
 }
 
-// SyncRedirects synchronizes the fetched redirects with the redirects map and the sqlite records
-func (rm *RedirectManager) SyncRedirects(redirectsCh <-chan []api.Redirect, errCh <-chan error) {
+// SyncRedirects synchronizes the fetched redirects with the rule sets and the sqlite records
+func (rm *RedirectManager) SyncRedirects(redirectsCh <-chan api.RedirectChanges, errCh <-chan error) {
 	for {
 		select {
-		case fetchedRedirects := <-redirectsCh:
-			if len(fetchedRedirects) > 0 {
-				if rm.lastSyncTime.IsZero() {
-					rm.lastSyncTime = time.Now().UTC()
-				}
-
-				rm.HandleOldRedirectsDeletion(&fetchedRedirects)
-				rm.HandleNewOrUpdatedRedirects(&fetchedRedirects)
-
-				rm.lastSyncTime = time.Now().UTC()
-				fmt.Println("Redirects synced at:", rm.lastSyncTime)
-				printRedirects(rm.redirects)
+		case changes := <-redirectsCh:
+			if err := rm.applyChanges(changes); err != nil {
+				syncErrors.Inc(changes.Source)
+				log.Println("Error syncing redirects:", err)
 			}
 		case err := <-errCh:
 			log.Println("Error syncing redirects:", err)
@@ -113,80 +283,280 @@ func (rm *RedirectManager) SyncRedirects(redirectsCh <-chan []api.Redirect, errC
 	}
 }
 
-func (rm *RedirectManager) HandleOldRedirectsDeletion(fetchedRedirects *[]api.Redirect) {
-	var fetchedRedirectsIDs = initializeRedirectMapIds(*fetchedRedirects)
+// syncPlan holds the changes of a sync, computed up front so they can be stored in a single transaction
+type syncPlan struct {
+	added   []api.Redirect
+	updated []api.Redirect
+	deleted []string
+}
+
+func (p *syncPlan) size() int {
+	return len(p.added) + len(p.updated) + len(p.deleted)
+}
+
+/*
+applyChanges applies a fetched change set to the sqlite records, the rule set of its source and the index.
+The records are written in a single transaction, the in-memory state only changes once it is committed.
+*/
+func (rm *RedirectManager) applyChanges(changes api.RedirectChanges) error {
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+	defer syncDuration.ObserveSince(time.Now(), changes.Source, "apply")
+
+	set := rm.ruleSet(changes.Source)
+	if set == nil {
+		return fmt.Errorf("unknown rule source %q", changes.Source)
+	}
+
+	// An empty snapshot of the Central API is most likely a failure on its side
+	if changes.Full && len(changes.Redirects) == 0 && changes.Source == CentralSourceName {
+		log.Println("Skipping empty redirects snapshot")
+		return nil
+	}
 
-	for id, r := range rm.redirects {
+	plan := &syncPlan{}
+	if changes.Full {
+		plan.deleted = planOldRedirectsDeletion(set, changes.Redirects)
+	} else {
+		plan.deleted = planDeletedRedirects(set, changes.Tombstones)
+	}
+	plan.added, plan.updated = planNewOrUpdatedRedirects(set, changes.Redirects)
+
+	// Pushed changes keep the last watermark, the catch-up sync after a reconnect still fetches the changes missed before them
+	watermark := rm.Watermark(changes.Source)
+	if !changes.Pushed && changes.Watermark != "" {
+		watermark = changes.Watermark
+	}
+
+	/*
+		Hold back the deletions when there are suspiciously many, e.g. due to a truncated result or a wrong HOST_ID.
+		The watermark is not advanced, so the held tombstones are fetched again until the deletions are approved.
+	*/
+	var held *pendingDeletions
+	if rm.deletionThreshold.Exceeds(len(plan.deleted), len(set.redirects)) {
+		log.Printf("Holding back %d of %d %s redirect deletions, exceeding the deletion threshold of %s\n",
+			len(plan.deleted), len(set.redirects), set.source.Name(), rm.deletionThreshold)
+		held = &pendingDeletions{ids: plan.deleted, watermark: watermark}
+		plan.deleted = nil
+		watermark = rm.Watermark(changes.Source)
+	}
+
+	rm.mu.RLock()
+	state := SyncState{
+		Source:         changes.Source,
+		LastSyncTime:   time.Now().UTC(),
+		Watermark:      watermark,
+		RuleSetVersion: rm.status.RuleSetVersion,
+		RuleCount:      len(set.redirects) + len(plan.added) - len(plan.deleted),
+	}
+	// A push isn't a sync, the source is only up to date after the next fetch
+	if changes.Pushed {
+		state.LastSyncTime = set.status.LastSuccess
+	}
+	rm.mu.RUnlock()
+
+	if plan.size() > 0 {
+		state.RuleSetVersion++
+	}
+
+	if err := rm.storeSyncPlan(set, plan, state); err != nil {
+		rm.mu.Lock()
+		set.status.LastError = err.Error()
+		rm.mu.Unlock()
+
+		return fmt.Errorf("error storing the synced redirects: %v", err)
+	}
+
+	rm.applySyncPlan(set, plan)
+	logSyncPlan(plan)
+	recordSyncPlan(set, plan)
+
+	rm.mu.Lock()
+	set.watermark = watermark
+	// A push only holds the changes it carries, it doesn't replace the deletions held back by the previous sync
+	switch {
+	case changes.Pushed && held != nil && set.pending != nil:
+		set.pending.ids = append(set.pending.ids, held.ids...)
+	case !changes.Pushed || held != nil:
+		set.pending = held
+	}
+	lastError := ""
+	if changes.Pushed {
+		lastError = set.status.LastError
+	}
+	set.status = SourceStatus{
+		LastAttempt: set.status.LastAttempt,
+		LastSuccess: state.LastSyncTime,
+		LastError:   lastError,
+		Added:       len(plan.added),
+		Updated:     len(plan.updated),
+		Deleted:     len(plan.deleted),
+		RuleCount:   len(set.redirects),
+	}
+	if set.pending != nil {
+		set.status.PendingDeletions = len(set.pending.ids)
+	}
+	rm.status.RuleSetVersion = state.RuleSetVersion
+	rm.status.RuleCount = rm.ruleCount()
+	rm.mu.Unlock()
+
+	if plan.size() > 0 {
+		rm.scheduleConflictAnalysis()
+	}
+
+	if plan.size() > 0 {
+		fmt.Println("Redirects synced at:", state.LastSyncTime)
+		printRedirects(set.redirects)
+	}
+
+	return nil
+}
+
+// ruleCount returns the number of redirects of all sources
+func (rm *RedirectManager) ruleCount() int {
+	count := 0
+	for _, set := range rm.sources {
+		count += len(set.redirects)
+	}
+
+	return count
+}
+
+// planOldRedirectsDeletion returns the ids of the stored redirects that are missing from a full snapshot
+func planOldRedirectsDeletion(set *ruleSet, fetchedRedirects []api.Redirect) []string {
+	var fetchedRedirectsIDs = initializeRedirectMapIds(fetchedRedirects)
+
+	var deleted []string
+	for id := range set.redirects {
 		if !fetchedRedirectsIDs[id] {
-			delete(rm.redirects, id)
-			// Delete from IndexedRedirects as well
-			rm.IndexedRedirects.Delete(r.FromURL, r.FromDomain)
-
-			// Delete from the database
-			err := rm.DeleteOldRedirect(id)
-			if err != nil {
-				log.Println("Error deleting old redirects:", err)
-			} else {
-				log.Println("Deleted old redirect:", id)
-			}
+			deleted = append(deleted, id)
 		}
 	}
+
+	return deleted
 }
 
-func (rm *RedirectManager) HandleNewOrUpdatedRedirects(fetchedRedirects *[]api.Redirect) {
-	for _, fr := range *fetchedRedirects {
-		// Check if redirect exists in map
-		if r, ok := rm.redirects[fr.Id]; ok {
-			if fr.UpdatedAt.After(rm.lastSyncTime) {
-				*r = fr
+// planDeletedRedirects returns the ids of the stored redirects that the source reported as tombstones
+func planDeletedRedirects(set *ruleSet, tombstones []api.Tombstone) []string {
+	var deleted []string
+	for _, t := range tombstones {
+		if _, ok := set.redirects[t.Id]; ok {
+			deleted = append(deleted, t.Id)
+		}
+	}
 
-				rm.IndexedRedirects.Update(r.FromURL, r.FromDomain, r.ToURL)
-				log.Println("Redirect updated:", fr.Id)
+	return deleted
+}
 
-				err := rm.UpsertRedirect(fr)
-				if err != nil {
-					log.Println("Error updating redirect in the database:", err)
-				}
-			}
-		} else {
-			rm.redirects[fr.Id] = &fr
-			rm.IndexedRedirects.IndexRule(fr.FromURL, fr.FromDomain, fr.ToURL)
-			log.Println("Redirect added:", fr.Id)
+func planNewOrUpdatedRedirects(set *ruleSet, fetchedRedirects []api.Redirect) (added []api.Redirect, updated []api.Redirect) {
+	// Only the last occurrence of a redirect in the change set counts
+	latest := make(map[string]int, len(fetchedRedirects))
+	for i, fr := range fetchedRedirects {
+		latest[fr.Id] = i
+	}
 
-			err := rm.UpsertRedirect(fr)
-			if err != nil {
-				log.Println("Error storing new redirect in the database:", err)
+	for i, fr := range fetchedRedirects {
+		if latest[fr.Id] != i {
+			continue
+		}
+		// Check if redirect exists in map
+		if r, ok := set.redirects[fr.Id]; ok {
+			if isRedirectChanged(r, &fr) {
+				updated = append(updated, fr)
 			}
+		} else {
+			added = append(added, fr)
 		}
 	}
+
+	return added, updated
 }
 
-func (rm *RedirectManager) UpsertRedirect(r api.Redirect) error {
-	stmt := `
-			INSERT INTO redirects (id, fromURL, fromDomain, toURL, updatedAt)
-			VALUES (?, ?, ?, ?, ?)
-			ON CONFLICT(id) DO UPDATE
-			SET fromURL = EXCLUDED.fromURL, fromDomain = EXCLUDED.fromDomain, toURL = EXCLUDED.toURL, updatedAt = EXCLUDED.updatedAt;
-			`
+// storeSyncPlan writes the planned changes and the new sync state in a single transaction
+func (rm *RedirectManager) storeSyncPlan(set *ruleSet, plan *syncPlan, state SyncState) error {
+	tx, err := rm.db.Begin()
+	if err != nil {
+		return err
+	}
 
-	_, err := rm.db.Exec(stmt, r.Id, r.FromURL, r.FromDomain, r.ToURL, r.UpdatedAt, r.FromURL, r.ToURL, r.UpdatedAt)
+	err = storeRedirects(tx, set.source.Name(), plan)
+	if err == nil {
+		err = SaveSyncState(tx, state)
+	}
 	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Println("Error rolling back the sync transaction:", rollbackErr)
+		}
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (rm *RedirectManager) DeleteOldRedirect(id string) error {
-	stmt := `DELETE FROM redirects WHERE id = ?;`
+func storeRedirects(tx *sql.Tx, source string, plan *syncPlan) error {
+	deleteStmt, err := tx.Prepare(`DELETE FROM redirects WHERE source = ? AND id = ?;`)
+	if err != nil {
+		return err
+	}
+	defer deleteStmt.Close()
 
-	_, err := rm.db.Exec(stmt, id)
+	for _, id := range plan.deleted {
+		if _, err := deleteStmt.Exec(source, id); err != nil {
+			return fmt.Errorf("error deleting redirect %s: %v", id, err)
+		}
+	}
+
+	upsertStmt, err := tx.Prepare(`
+			INSERT INTO redirects (source, id, fromURL, fromDomain, toURL, updatedAt, statusCode)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(source, id) DO UPDATE
+			SET fromURL = EXCLUDED.fromURL, fromDomain = EXCLUDED.fromDomain, toURL = EXCLUDED.toURL,
+			    updatedAt = EXCLUDED.updatedAt, statusCode = EXCLUDED.statusCode;
+			`)
 	if err != nil {
 		return err
 	}
+	defer upsertStmt.Close()
+
+	for _, batch := range [][]api.Redirect{plan.added, plan.updated} {
+		for _, r := range batch {
+			if _, err := upsertStmt.Exec(source, r.Id, r.FromURL, r.FromDomain, r.ToURL, r.UpdatedAt, r.StatusCode); err != nil {
+				return fmt.Errorf("error storing redirect %s: %v", r.Id, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// recordSyncPlan counts the changes of a sync in the metrics
+func recordSyncPlan(set *ruleSet, plan *syncPlan) {
+	syncChanges.Add(float64(len(plan.added)), set.source.Name(), "added")
+	syncChanges.Add(float64(len(plan.updated)), set.source.Name(), "updated")
+	syncChanges.Add(float64(len(plan.deleted)), set.source.Name(), "deleted")
+}
+
+func logSyncPlan(plan *syncPlan) {
+	for _, id := range plan.deleted {
+		log.Println("Deleted old redirect:", id)
+	}
+	for _, r := range plan.updated {
+		log.Println("Redirect updated:", r.Id)
+	}
+	for _, r := range plan.added {
+		log.Println("Redirect added:", r.Id)
+	}
+}
+
+// isRedirectChanged compares the stored redirect with the fetched one, independent of any local clock
+func isRedirectChanged(stored, fetched *api.Redirect) bool {
+	return stored.FromURL != fetched.FromURL ||
+		stored.FromDomain != fetched.FromDomain ||
+		stored.ToURL != fetched.ToURL ||
+		stored.StatusCode != fetched.StatusCode ||
+		!stored.UpdatedAt.Equal(fetched.UpdatedAt)
+}
+
 // Initialize a map of ids for quicker lookup
 func initializeRedirectMapIds(fetchedRedirects []api.Redirect) map[string]bool {
 	var fetchedRedirectsIDs = make(map[string]bool)
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRedirectManager(t *testing.T) *RedirectManager {
+	return openTestRedirectManager(t, filepath.Join(t.TempDir(), "redirects.db"))
+}
+
+// openTestRedirectManager opens a RedirectManager on the database file, with only the central source unless given others
+func openTestRedirectManager(t *testing.T, dbFile string, sources ...RuleSource) *RedirectManager {
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if len(sources) == 0 {
+		sources = []RuleSource{NewCentralSource(nil)}
+	}
+	rm := NewRedirectManager(db, sources, time.Hour, DeletionThreshold{})
+	rm.PopulateMapsWithDataFromDB()
+
+	return rm
+}
+
+func TestRedirectManager_ApplyChanges(t *testing.T) {
+	rm := newTestRedirectManager(t)
+	updatedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items", UpdatedAt: updatedAt},
+			{Id: "2", FromURL: "/home/careers", ToURL: "/careers", UpdatedAt: updatedAt},
+		},
+		Watermark: "w1",
+		Full:      true,
+	})
+
+	// The update is older than the local clock, but is still applied since it is part of the change set
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "/school/assignments", ToURL: "/school/tasks", UpdatedAt: updatedAt.Add(time.Minute)},
+		},
+		Tombstones: []api.Tombstone{{Id: "2", DeletedAt: updatedAt}},
+		Watermark:  "w2",
+	})
+
+	status := rm.Status().Sources[CentralSourceName]
+	if status.Updated != 1 || status.Deleted != 1 || status.Added != 0 {
+		t.Errorf("unexpected sync status counts: %+v", status)
+	}
+
+	if rm.Watermark(CentralSourceName) != "w2" {
+		t.Errorf("unexpected watermark: got %v want %v", rm.Watermark(CentralSourceName), "w2")
+	}
+
+	if redirectURL, _ := rm.IndexedRedirects.Match("/school/assignments"); redirectURL != "/school/tasks" {
+		t.Errorf("updated redirect not applied: got %v want %v", redirectURL, "/school/tasks")
+	}
+
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); ok {
+		t.Errorf("tombstoned redirect still matches")
+	}
+
+	var count int
+	if err := rm.db.QueryRow("SELECT COUNT(*) FROM redirects").Scan(&count); err != nil {
+		t.Fatalf("Failed to count redirects: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("unexpected number of stored redirects: got %v want %v", count, 1)
+	}
+}
+
+func TestRedirectManager_ResumesSyncState(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "redirects.db")
+	rm := openTestRedirectManager(t, dbFile)
+
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"}},
+		Watermark: "w1",
+		Full:      true,
+	})
+
+	// Simulate a restart on the same database
+	restarted := openTestRedirectManager(t, dbFile)
+
+	if restarted.Watermark(CentralSourceName) != "w1" {
+		t.Errorf("watermark not resumed: got %v want %v", restarted.Watermark(CentralSourceName), "w1")
+	}
+
+	status := restarted.Status()
+	lastSuccess := rm.Status().Sources[CentralSourceName].LastSuccess
+	if resumed := status.Sources[CentralSourceName].LastSuccess; !resumed.Equal(lastSuccess) {
+		t.Errorf("last sync time not resumed: got %v want %v", resumed, lastSuccess)
+	}
+	if status.RuleSetVersion != 1 || status.RuleCount != 1 {
+		t.Errorf("unexpected rule set version or count: %+v", status)
+	}
+}
+
+func TestRedirectManager_ResumesSyncStateBySource(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "redirects.db")
+	open := func() *RedirectManager {
+		return openTestRedirectManager(t, dbFile, NewCentralSource(nil), NewFileSource(filepath.Join(t.TempDir(), "rules.csv")))
+	}
+	rm := open()
+
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"}},
+		Watermark: "w1",
+		Full:      true,
+	})
+	// The sync of the next source doesn't overwrite the position of the first one
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    FileSourceName,
+		Redirects: []api.Redirect{{Id: "2", FromURL: "/home/careers", ToURL: "/careers"}},
+		Watermark: "f1",
+		Full:      true,
+	})
+
+	restarted := open()
+	if watermark := restarted.Watermark(CentralSourceName); watermark != "w1" {
+		t.Errorf("central watermark not resumed: got %v want %v", watermark, "w1")
+	}
+	if watermark := restarted.Watermark(FileSourceName); watermark != "f1" {
+		t.Errorf("file watermark not resumed: got %v want %v", watermark, "f1")
+	}
+	if status := restarted.Status(); status.RuleSetVersion != 2 || status.RuleCount != 2 {
+		t.Errorf("unexpected rule set version or count: %+v", status)
+	}
+}
+
+func TestRedirectManager_ApplyChanges_PushedKeepsWatermark(t *testing.T) {
+	rm := newTestRedirectManager(t)
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"}},
+		Watermark: "w1",
+		Full:      true,
+	})
+
+	// A push after a reconnect may come before the changes missed while disconnected were fetched
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "2", FromURL: "/home/careers", ToURL: "/careers", StatusCode: 301}},
+		Watermark: "w3",
+		Pushed:    true,
+	}); err != nil {
+		t.Fatalf("Failed to apply pushed changes: %v", err)
+	}
+
+	if rm.Watermark(CentralSourceName) != "w1" {
+		t.Errorf("watermark advanced by a push: got %v want %v", rm.Watermark(CentralSourceName), "w1")
+	}
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); !ok {
+		t.Errorf("pushed redirect not applied")
+	}
+}
+
+func TestRedirectManager_ApplyChanges_RollsBackOnFailure(t *testing.T) {
+	rm := newTestRedirectManager(t)
+	_ = rm.applyChanges(api.RedirectChanges{
+		Source:    CentralSourceName,
+		Redirects: []api.Redirect{{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"}},
+		Watermark: "w1",
+		Full:      true,
+	})
+
+	// Make the sqlite write fail halfway through the batch
+	_, err := rm.db.Exec(`
+		CREATE TRIGGER fail_insert BEFORE INSERT ON redirects WHEN NEW.id = 'broken'
+		BEGIN SELECT RAISE(ABORT, 'broken redirect'); END;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	err = rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "2", FromURL: "/home/careers", ToURL: "/careers"},
+			{Id: "broken", FromURL: "/broken", ToURL: "/"},
+		},
+		Tombstones: []api.Tombstone{{Id: "1"}},
+		Watermark:  "w2",
+	})
+	if err == nil {
+		t.Fatalf("expected the sync to fail")
+	}
+
+	if rm.Watermark(CentralSourceName) != "w1" {
+		t.Errorf("watermark advanced after a failed sync: got %v want %v", rm.Watermark(CentralSourceName), "w1")
+	}
+	if _, ok := rm.IndexedRedirects.Match("/school/assignments"); !ok {
+		t.Errorf("deleted redirect removed from the index after a failed sync")
+	}
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); ok {
+		t.Errorf("added redirect indexed after a failed sync")
+	}
+
+	var count int
+	if err := rm.db.QueryRow("SELECT COUNT(*) FROM redirects").Scan(&count); err != nil {
+		t.Fatalf("Failed to count redirects: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("failed sync was partially stored: got %v redirects want %v", count, 1)
+	}
+	if rm.Status().Sources[CentralSourceName].LastError == "" {
+		t.Errorf("failed sync not reported in the sync status")
+	}
+}
+
+func TestRetryDelay_Backoff(t *testing.T) {
+	maxDelay := time.Hour
+
+	for failures := 1; failures <= 40; failures++ {
+		expected := maxDelay
+		if failures < 32 && retryBaseDelay<<(failures-1) < maxDelay {
+			expected = retryBaseDelay << (failures - 1)
+		}
+
+		delay := retryDelay(failures, maxDelay)
+		if delay < expected/2 || delay > expected {
+			t.Errorf("retry delay out of bounds for %d failures: got %v want between %v and %v", failures, delay, expected/2, expected)
+		}
+	}
+}
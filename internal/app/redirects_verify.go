@@ -0,0 +1,238 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxRedirectChain stops following a chain of redirects, a chain this long is most likely a loop through growing URLs
+const maxRedirectChain = 20
+
+// The outcomes of verifying a URL
+const (
+	VerifyPass     = "pass"
+	VerifyMismatch = "mismatch"
+	VerifyNoMatch  = "no-match"
+	VerifyLoop     = "loop"
+)
+
+// VerifyCase is a URL with the destination it is expected to end up at, an empty destination expects no redirect
+type VerifyCase struct {
+	URL      string `json:"url"`
+	Expected string `json:"expected"`
+}
+
+// VerifyResult is the outcome of following the redirects of a URL
+type VerifyResult struct {
+	VerifyCase
+	Status string `json:"status"`
+	// Actual is the destination at the end of the chain, every redirect of the chain is a hop
+	Actual      string   `json:"actual"`
+	Chain       []string `json:"chain"`
+	ChainLength int      `json:"chainLength"`
+}
+
+// VerifyReport is the outcome of a verification run
+type VerifyReport struct {
+	Passed  int            `json:"passed"`
+	Failed  int            `json:"failed"`
+	Results []VerifyResult `json:"results"`
+}
+
+// verifyColumns are the columns of a CSV report
+var verifyColumns = []string{"url", "expected", "status", "actual", "chainLength", "chain"}
+
+/*
+ReadVerifyCases reads the URLs to verify from a JSON array of url and expected objects, or from a CSV file:
+
+	url,expected
+	/old-page,/new-page
+	https://old-domain.com/about,https://new-domain.com/about
+*/
+func ReadVerifyCases(r io.Reader, format string) ([]VerifyCase, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []VerifyCase
+	switch format {
+	case JSONFormat:
+		if err := json.Unmarshal(content, &cases); err != nil {
+			return nil, fmt.Errorf("error parsing URLs: %v", err)
+		}
+	case CSVFormat:
+		records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing URLs: %v", err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		columns := make(map[string]int)
+		for i, name := range records[0] {
+			columns[strings.TrimSpace(name)] = i
+		}
+		if _, ok := columns["url"]; !ok {
+			return nil, fmt.Errorf("missing url column in the CSV header")
+		}
+
+		field := func(record []string, name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		for _, record := range records[1:] {
+			cases = append(cases, VerifyCase{URL: field(record, "url"), Expected: field(record, "expected")})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	for i, vc := range cases {
+		if vc.URL == "" {
+			return nil, fmt.Errorf("URL %d is empty", i+1)
+		}
+	}
+
+	return cases, nil
+}
+
+/*
+Verify follows the redirects of every URL the way the plugin matches them, and compares where they end up with
+the expected destinations. Relative targets and destinations are resolved against the host of a full URL.
+The hits of the rules aren't counted.
+*/
+func (idx *IndexedRedirects) Verify(cases []VerifyCase) VerifyReport {
+	report := VerifyReport{Results: make([]VerifyResult, 0, len(cases))}
+	for _, vc := range cases {
+		result := idx.verify(vc)
+		if result.Status == VerifyPass {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+func (idx *IndexedRedirects) verify(vc VerifyCase) VerifyResult {
+	result := VerifyResult{VerifyCase: vc, Chain: []string{}}
+
+	visited := map[string]bool{strings.ToLower(vc.URL): true}
+	current := vc.URL
+	for {
+		target, ok := idx.redirectOnce(current)
+		if !ok {
+			break
+		}
+		result.Chain = append(result.Chain, target)
+		current = target
+
+		if visited[strings.ToLower(target)] || len(result.Chain) >= maxRedirectChain {
+			result.Status = VerifyLoop
+			break
+		}
+		visited[strings.ToLower(target)] = true
+	}
+	result.ChainLength = len(result.Chain)
+	if len(result.Chain) > 0 {
+		result.Actual = current
+	}
+
+	switch {
+	case result.Status == VerifyLoop:
+	case len(result.Chain) == 0 && vc.Expected != "":
+		result.Status = VerifyNoMatch
+	case result.Actual == resolveTarget(vc.URL, vc.Expected):
+		result.Status = VerifyPass
+	default:
+		result.Status = VerifyMismatch
+	}
+
+	return result
+}
+
+// redirectOnce returns where the plugin redirects a URL to
+func (idx *IndexedRedirects) redirectOnce(rawURL string) (string, bool) {
+	rule, matches := idx.lookupURL(rawURL)
+	if rule == nil {
+		return "", false
+	}
+
+	return resolveTarget(rawURL, rule.render(matches)), true
+}
+
+// lookupURL matches a URL the way the plugin does, the full URL first and then its path without the query string
+func (idx *IndexedRedirects) lookupURL(rawURL string) (*Rule, []string) {
+	for _, request := range urlRequests(rawURL) {
+		if rule, matches := idx.lookup(request); rule != nil {
+			return rule, matches
+		}
+	}
+
+	return nil, nil
+}
+
+// urlRequests returns the requests the plugin asks about for a URL, in their order
+func urlRequests(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	if u.Scheme == "http" || u.Scheme == "https" {
+		return []string{strings.ToLower(u.Scheme + "://" + u.Host + path), path}
+	}
+
+	return []string{path}
+}
+
+// resolveTarget makes a relative target absolute with the scheme and host of a full URL, as the plugin does
+func resolveTarget(rawURL, target string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || !strings.HasPrefix(target, "/") {
+		return target
+	}
+
+	return u.Scheme + "://" + u.Host + target
+}
+
+// WriteVerifyReport writes the report as JSON, or its results as CSV
+func WriteVerifyReport(w io.Writer, report VerifyReport, format string) error {
+	switch format {
+	case JSONFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case CSVFormat:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(verifyColumns); err != nil {
+			return err
+		}
+		for _, result := range report.Results {
+			record := []string{result.URL, result.Expected, result.Status, result.Actual, strconv.Itoa(result.ChainLength), strings.Join(result.Chain, " -> ")}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
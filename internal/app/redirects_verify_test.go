@@ -0,0 +1,70 @@
+package app
+
+import (
+	"bytes"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"strings"
+	"testing"
+)
+
+const testVerifyCSV = `url,expected
+/old,/newest
+/old,/new
+/missing,/somewhere
+/a,/c
+https://old-domain.com/old,https://new-domain.com/newest
+https://example.com/old,/newest
+/untouched,
+`
+
+func TestIndexedRedirects_Verify(t *testing.T) {
+	idx := NewIndexedRedirects()
+	idx.IndexRedirect(api.Redirect{Id: "old", FromURL: "^/old$", ToURL: "/new"})
+	idx.IndexRule("^/new$", "", "/newest")
+	idx.IndexRule("^/a$", "", "/b")
+	idx.IndexRule("^/b$", "", "/a")
+	idx.IndexRule("", `^https?://old-domain\.com/(.*)$`, "https://new-domain.com/$1")
+
+	cases, err := ReadVerifyCases(strings.NewReader(testVerifyCSV), CSVFormat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	report := idx.Verify(cases)
+
+	expected := []struct {
+		status      string
+		actual      string
+		chainLength int
+	}{
+		{status: VerifyPass, actual: "/newest", chainLength: 2},
+		{status: VerifyMismatch, actual: "/newest", chainLength: 2},
+		{status: VerifyNoMatch, chainLength: 0},
+		{status: VerifyLoop, actual: "/a", chainLength: 2},
+		// The path rules apply to the new domain as well
+		{status: VerifyPass, actual: "https://new-domain.com/newest", chainLength: 3},
+		{status: VerifyPass, actual: "https://example.com/newest", chainLength: 2},
+		{status: VerifyPass, chainLength: 0},
+	}
+	if len(report.Results) != len(expected) || report.Passed != 4 || report.Failed != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	for i, result := range report.Results {
+		if result.Status != expected[i].status || result.Actual != expected[i].actual || result.ChainLength != expected[i].chainLength {
+			t.Errorf("unexpected result for %s: got %+v want %+v", result.URL, result, expected[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteVerifyReport(&buf, report, CSVFormat); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line := strings.Split(buf.String(), "\n")[1]; line != "/old,/newest,pass,/newest,2,/new -> /newest" {
+		t.Errorf("unexpected CSV line: %s", line)
+	}
+
+	// Verifying doesn't count as a hit
+	if hits := idx.unflushedHits("", "old"); hits != 0 {
+		t.Errorf("unexpected hits: got %d want 0", hits)
+	}
+}
@@ -7,22 +7,32 @@ import (
 	"github.com/robfig/cron/v3"
 	"log"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
+// CachedHit counts the requests for a URL the plugin answered from its cache, without asking the app
+type CachedHit struct {
+	URL     string    `json:"url"`
+	Count   int64     `json:"count"`
+	LastHit time.Time `json:"lastHit"`
+}
+
 type Logger struct {
 	fileName    string
 	requestsMap map[string]time.Time
-	mutex       sync.Mutex
+	// requestHits counts the logged requests by URL
+	requestHits map[string]int64
+	writer      *logWriter
 	gqlClient   *v1.GraphQLClient
 }
 
 func NewLogger(fileName string, gqlClient *v1.GraphQLClient) *Logger {
 	return &Logger{
 		requestsMap: make(map[string]time.Time),
-		mutex:       sync.Mutex{},
+		requestHits: make(map[string]int64),
+		writer:      newLogWriter(fileName),
 		fileName:    fileName,
 		gqlClient:   gqlClient,
 	}
@@ -46,7 +56,23 @@ func (l *Logger) SendLogs() {
 		log.Println(err)
 	}
 
-	response, err := l.gqlClient.ExecuteLogRequestsMutation(&l.requestsMap)
+	// Without the Central API, e.g. in the file mode, the logs are only kept locally
+	if l.gqlClient == nil {
+		log.Printf("Kept %d logged requests locally\n", len(l.requestsMap))
+		return
+	}
+
+	logsInput := make([]v1.LogRequestsInput, 0, len(l.requestsMap))
+	for requestURL, hitTime := range l.requestsMap {
+		logsInput = append(logsInput, v1.LogRequestsInput{RequestURL: requestURL, HitTime: hitTime, Hits: l.requestHits[requestURL]})
+	}
+
+	response, err := l.gqlClient.ExecuteLogRequestsMutation(logsInput)
+	if err != nil || !response.Success {
+		logUploads.Inc("failure")
+	} else {
+		logUploads.Inc("success")
+	}
 	if err != nil {
 		log.Println("Failed to execute GraphQL mutation:", err)
 	}
@@ -54,8 +80,16 @@ func (l *Logger) SendLogs() {
 	log.Println(response.Message)
 }
 
-// LoadLoggedRequests loads the requestsMap with data from the .log file
+/*
+LoadLoggedRequests loads the requestsMap and the requestHits with data from the .log file.
+Every line is a request, or a count of cached requests with a third field.
+*/
 func (l *Logger) LoadLoggedRequests() error {
+	// The queued requests are written first, so they are loaded too
+	if err := l.writer.Flush(); err != nil {
+		log.Println(err)
+	}
+
 	file, err := os.OpenFile(l.fileName, os.O_APPEND|os.O_CREATE|os.O_RDONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("error opening file: %v", err)
@@ -68,11 +102,14 @@ func (l *Logger) LoadLoggedRequests() error {
 		}
 	}()
 
+	// The hits are counted over the whole file again
+	l.requestHits = make(map[string]int64)
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
 		fields := strings.Split(line, ",")
-		if len(fields) != 2 {
+		if len(fields) != 2 && len(fields) != 3 {
 			continue
 		}
 
@@ -84,9 +121,17 @@ func (l *Logger) LoadLoggedRequests() error {
 			continue
 		}
 
+		hits := int64(1)
+		if len(fields) == 3 {
+			if hits, err = strconv.ParseInt(fields[2], 10, 64); err != nil || hits < 1 {
+				continue
+			}
+		}
+
 		if existingTimestamp, ok := l.requestsMap[requestURL]; !ok || timestamp.After(existingTimestamp) {
 			l.requestsMap[requestURL] = timestamp
 		}
+		l.requestHits[requestURL] += hits
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -96,28 +141,34 @@ func (l *Logger) LoadLoggedRequests() error {
 	return nil
 }
 
-// LogRequest logs any incoming requests with dates to the .log file
+// LogRequest queues a request with its date for the .log file, it is dropped rather than delaying the match when the queue is full
 func (l *Logger) LogRequest(requestURL string) error {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	return l.writer.tryWrite(fmt.Sprintf("%s,%s\n", requestURL, time.Now().Format(time.RFC3339)))
+}
 
-	file, err := os.OpenFile(l.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+// LogCachedHits logs the requests the plugin answered from its cache, so the sent logs count all requests
+func (l *Logger) LogCachedHits(hits []CachedHit) error {
+	var entries strings.Builder
+	for _, hit := range hits {
+		if hit.URL == "" || hit.Count < 1 {
+			return fmt.Errorf("invalid cached hit of %q", hit.URL)
+		}
+		if hit.LastHit.IsZero() {
+			hit.LastHit = time.Now()
+		}
+		entries.WriteString(fmt.Sprintf("%s,%s,%d\n", hit.URL, hit.LastHit.Format(time.RFC3339), hit.Count))
 	}
 
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			log.Println("Error closing file:", err)
-		}
-	}()
+	// The counts can't be logged again later, so they wait for room in the queue
+	return l.writer.write(entries.String())
+}
 
-	// Write to log file
-	logEntry := fmt.Sprintf("%s,%s\n", requestURL, time.Now().Format(time.RFC3339))
-	if _, err := file.WriteString(logEntry); err != nil {
-		return fmt.Errorf("failed to write to log file: %v", err)
-	}
+// Flush writes the queued requests to the .log file
+func (l *Logger) Flush() error {
+	return l.writer.Flush()
+}
 
-	return nil
+// Close writes the queued requests to the .log file and closes it, requests logged afterward return an error
+func (l *Logger) Close() error {
+	return l.writer.Close()
 }
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger_LogCachedHits(t *testing.T) {
+	logger := NewLogger(filepath.Join(t.TempDir(), "requests.log"), nil)
+	t.Cleanup(func() { _ = logger.Close() })
+
+	for i := 0; i < 2; i++ {
+		if err := logger.LogRequest("/about"); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+	lastHit := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := logger.LogCachedHits([]CachedHit{{URL: "/about", Count: 5, LastHit: lastHit}, {URL: "/contact", Count: 1}}); err != nil {
+		t.Fatalf("Failed to log cached hits: %v", err)
+	}
+	if err := logger.LogCachedHits([]CachedHit{{URL: "/about", Count: 0}}); err == nil {
+		t.Errorf("expected an error for an empty count")
+	}
+
+	// Loading the log again counts the hits from scratch
+	for i := 0; i < 2; i++ {
+		if err := logger.LoadLoggedRequests(); err != nil {
+			t.Fatalf("Failed to load logged requests: %v", err)
+		}
+	}
+	if hits := logger.requestHits["/about"]; hits != 7 {
+		t.Errorf("unexpected hits: got %v want 7", hits)
+	}
+	if hitTime := logger.requestsMap["/about"]; !hitTime.Equal(lastHit) {
+		t.Errorf("unexpected hit time: got %v want %v", hitTime, lastHit)
+	}
+	if hits := logger.requestHits["/contact"]; hits != 1 {
+		t.Errorf("unexpected hits: got %v want 1", hits)
+	}
+}
+
+func TestLogger_Close(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "requests.log")
+	logger := NewLogger(fileName, nil)
+
+	for i := 0; i < 100; i++ {
+		if err := logger.LogRequest(fmt.Sprintf("/page-%d", i)); err != nil {
+			t.Fatalf("Failed to log request: %v", err)
+		}
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Failed to close the logger: %v", err)
+	}
+
+	// The queued requests are written when closing
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Failed to read the log file: %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 100 {
+		t.Errorf("unexpected logged lines: got %v want 100", lines)
+	}
+
+	if err := logger.LogRequest("/about"); err == nil {
+		t.Errorf("expected an error after closing")
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("unexpected error closing twice: %v", err)
+	}
+}
+
+func TestLogWriter_DropsWhenFull(t *testing.T) {
+	// Without its goroutine the queue of the writer isn't emptied
+	w := &logWriter{lines: make(chan string, 1)}
+
+	for i := 0; i < 3; i++ {
+		if err := w.tryWrite("/about\n"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	if dropped := w.dropped.Load(); dropped != 2 {
+		t.Errorf("unexpected dropped lines: got %v want 2", dropped)
+	}
+}
+
+// logRequestUnbuffered logs a request the way LogRequest did before the logWriter, for comparison
+func logRequestUnbuffered(mutex *sync.Mutex, fileName, requestURL string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(fmt.Sprintf("%s,%s\n", requestURL, time.Now().Format(time.RFC3339)))
+	return err
+}
+
+func BenchmarkLogger_LogRequest(b *testing.B) {
+	logger := NewLogger(filepath.Join(b.TempDir(), "requests.log"), nil)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := logger.LogRequest("/about"); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	// Writing out the queue is part of the cost
+	if err := logger.Close(); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(logger.writer.dropped.Load())/float64(b.N), "dropped/op")
+}
+
+func BenchmarkLogger_LogRequestUnbuffered(b *testing.B) {
+	fileName := filepath.Join(b.TempDir(), "requests.log")
+	var mutex sync.Mutex
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := logRequestUnbuffered(&mutex, fileName, "/about"); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"github.com/robfig/cron/v3"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// ruleHitsFlushInterval is how often the hits counted in memory are added to the sqlite records
+const ruleHitsFlushInterval = time.Minute
+
+// ruleHitsKey identifies the rule the hits are counted for, the ids of the rules are only unique within their source
+type ruleHitsKey struct {
+	Source string
+	RuleId string
+}
+
+// RuleHits counts the requests matched by a rule, along with the first and the last of them
+type RuleHits struct {
+	Source   string
+	RuleId   string
+	Hits     int64
+	FirstHit time.Time
+	LastHit  time.Time
+	// Unreported are the hits not uploaded to the Central API yet
+	Unreported int64
+}
+
+/*
+ruleCounter counts the matches of a rule since they were last stored, without locking, as every match counts one.
+The first and the last hit are unix nanoseconds, the first one is zero when there is no hit to store.
+*/
+type ruleCounter struct {
+	hits     atomic.Int64
+	firstHit atomic.Int64
+	lastHit  atomic.Int64
+}
+
+func (c *ruleCounter) add(at time.Time) {
+	c.firstHit.CompareAndSwap(0, at.UnixNano())
+	c.lastHit.Store(at.UnixNano())
+	c.hits.Add(1)
+}
+
+// take returns the hits counted since the last call and starts counting from zero
+func (c *ruleCounter) take(key ruleHitsKey) (RuleHits, bool) {
+	hits := c.hits.Swap(0)
+	firstHit, lastHit := c.firstHit.Swap(0), c.lastHit.Load()
+	if hits == 0 {
+		return RuleHits{}, false
+	}
+	// A hit counted while taking the others can miss its first hit
+	if firstHit == 0 {
+		firstHit = lastHit
+	}
+
+	return RuleHits{Source: key.Source, RuleId: key.RuleId, Hits: hits, FirstHit: time.Unix(0, firstHit), LastHit: time.Unix(0, lastHit)}, true
+}
+
+// restore counts taken hits again, after they couldn't be stored
+func (c *ruleCounter) restore(taken RuleHits) {
+	c.hits.Add(taken.Hits)
+	for {
+		firstHit := c.firstHit.Load()
+		if firstHit != 0 && firstHit < taken.FirstHit.UnixNano() {
+			return
+		}
+		if c.firstHit.CompareAndSwap(firstHit, taken.FirstHit.UnixNano()) {
+			return
+		}
+	}
+}
+
+/*
+takeRuleHits returns the hits of every rule counted since the last call and starts counting from zero.
+The retired counters of removed rules are dropped once their hits are taken.
+*/
+func (idx *IndexedRedirects) takeRuleHits() []RuleHits {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var taken []RuleHits
+	for key, counter := range idx.counters {
+		if hits, ok := counter.take(key); ok {
+			taken = append(taken, hits)
+		}
+	}
+	for key, counter := range idx.retired {
+		if hits, ok := counter.take(key); ok {
+			taken = append(taken, hits)
+		}
+		delete(idx.retired, key)
+	}
+
+	return taken
+}
+
+// restoreRuleHits counts taken hits again, after they couldn't be stored, the hits of removed rules are retired again
+func (idx *IndexedRedirects) restoreRuleHits(taken []RuleHits) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, hits := range taken {
+		key := ruleHitsKey{Source: hits.Source, RuleId: hits.RuleId}
+		counter, ok := idx.counters[key]
+		if !ok {
+			if counter, ok = idx.retired[key]; !ok {
+				counter = &ruleCounter{}
+				idx.retired[key] = counter
+			}
+		}
+		counter.restore(hits)
+	}
+}
+
+// retireCounter stops counting the hits of a removed rule, the ones not stored yet are kept until the next flush
+func (idx *IndexedRedirects) retireCounter(source, id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := ruleHitsKey{Source: source, RuleId: id}
+	counter, ok := idx.counters[key]
+	if !ok {
+		return
+	}
+	delete(idx.counters, key)
+
+	if retired, ok := idx.retired[key]; ok {
+		if hits, ok := counter.take(key); ok {
+			retired.restore(hits)
+		}
+		return
+	}
+	idx.retired[key] = counter
+}
+
+// unflushedHits returns the hits of the rule of the source that aren't stored yet
+func (idx *IndexedRedirects) unflushedHits(source, id string) int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if counter, ok := idx.counters[ruleHitsKey{Source: source, RuleId: id}]; ok {
+		return counter.hits.Load()
+	}
+
+	return 0
+}
+
+// PersistRuleHits adds the hits counted in memory to the sqlite records every ruleHitsFlushInterval
+func (rm *RedirectManager) PersistRuleHits() {
+	for range time.Tick(ruleHitsFlushInterval) {
+		if err := rm.FlushRuleHits(); err != nil {
+			log.Println("Error storing the rule hits:", err)
+		}
+	}
+}
+
+// FlushRuleHits adds the hits counted in memory to the sqlite records, they are counted again when storing them fails
+func (rm *RedirectManager) FlushRuleHits() error {
+	taken := rm.IndexedRedirects.takeRuleHits()
+	if len(taken) == 0 {
+		return nil
+	}
+
+	if err := storeRuleHits(rm.db, taken); err != nil {
+		rm.IndexedRedirects.restoreRuleHits(taken)
+		return err
+	}
+
+	return nil
+}
+
+// storeRuleHits adds the hits in a single transaction, the timestamps are stored in UTC seconds so they compare as text
+func storeRuleHits(db *sql.DB, taken []RuleHits) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting the transaction: %v", err)
+	}
+
+	stmt := `
+		INSERT INTO rule_hits (source, ruleId, hits, unreportedHits, firstHit, lastHit)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(source, ruleId) DO UPDATE
+		SET hits = hits + EXCLUDED.hits, unreportedHits = unreportedHits + EXCLUDED.unreportedHits,
+		    firstHit = MIN(firstHit, EXCLUDED.firstHit), lastHit = MAX(lastHit, EXCLUDED.lastHit);
+		`
+	for _, hits := range taken {
+		firstHit, lastHit := hits.FirstHit.UTC().Truncate(time.Second), hits.LastHit.UTC().Truncate(time.Second)
+		if _, err := tx.Exec(stmt, hits.Source, hits.RuleId, hits.Hits, hits.Hits, firstHit, lastHit); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error storing the hits of rule %s of the %s source: %v", hits.RuleId, hits.Source, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// StoredRuleHits returns the stored hits of the rules, only the ones with hits not uploaded yet when unreported is set
+func (rm *RedirectManager) StoredRuleHits(unreported bool) ([]RuleHits, error) {
+	query := "SELECT source, ruleId, hits, firstHit, lastHit, unreportedHits FROM rule_hits"
+	if unreported {
+		query += " WHERE unreportedHits > 0"
+	}
+
+	rows, err := rm.db.Query(query + " ORDER BY source, ruleId")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the rule hits: %v", err)
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("Error closing rows:", err)
+		}
+	}()
+
+	var stored []RuleHits
+	for rows.Next() {
+		var hits RuleHits
+		if err := rows.Scan(&hits.Source, &hits.RuleId, &hits.Hits, &hits.FirstHit, &hits.LastHit, &hits.Unreported); err != nil {
+			return nil, fmt.Errorf("error scanning the rule hits: %v", err)
+		}
+		stored = append(stored, hits)
+	}
+
+	return stored, rows.Err()
+}
+
+// markRuleHitsReported subtracts the uploaded hits from the unreported ones, the hits stored in the meantime stay unreported
+func (rm *RedirectManager) markRuleHitsReported(reported []RuleHits) error {
+	tx, err := rm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting the transaction: %v", err)
+	}
+
+	for _, hits := range reported {
+		stmt := "UPDATE rule_hits SET unreportedHits = unreportedHits - ? WHERE source = ? AND ruleId = ?"
+		if _, err := tx.Exec(stmt, hits.Unreported, hits.Source, hits.RuleId); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error marking the hits of rule %s of the %s source as reported: %v", hits.RuleId, hits.Source, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReportRuleHitsWeekly starts a cron job to upload the rule hits weekly
+func (rm *RedirectManager) ReportRuleHitsWeekly(gqlClient *api.GraphQLClient) {
+	c := cron.New()
+	_, err := c.AddFunc("@weekly", func() {
+		if err := rm.ReportRuleHits(gqlClient); err != nil {
+			log.Println("Error reporting the rule hits:", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Error scheduling cron job: %v", err)
+	}
+	c.Start()
+}
+
+/*
+ReportRuleHits uploads the total hits of the rules hit since the last upload.
+Only the rules of the Central API are reported, the ids of the other sources are unknown to it.
+*/
+func (rm *RedirectManager) ReportRuleHits(gqlClient *api.GraphQLClient) error {
+	if err := rm.FlushRuleHits(); err != nil {
+		return err
+	}
+
+	stored, err := rm.StoredRuleHits(true)
+	if err != nil {
+		return err
+	}
+	var unreported []RuleHits
+	for _, hits := range stored {
+		if hits.Source == CentralSourceName {
+			unreported = append(unreported, hits)
+		}
+	}
+	if len(unreported) == 0 {
+		return nil
+	}
+
+	input := make([]api.RuleHitsInput, 0, len(unreported))
+	for _, hits := range unreported {
+		input = append(input, api.RuleHitsInput{RuleId: hits.RuleId, Hits: hits.Hits, FirstHit: hits.FirstHit, LastHit: hits.LastHit})
+	}
+
+	response, err := gqlClient.ExecuteRuleHitsMutation(input)
+	if err != nil {
+		return err
+	}
+	if !response.Success {
+		return fmt.Errorf("rule hits rejected: %s", response.Message)
+	}
+
+	log.Printf("Reported the hits of %d rules\n", len(unreported))
+
+	return rm.markRuleHitsReported(unreported)
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectManager_FlushRuleHits(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	rm := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db)}, time.Hour, DeletionThreshold{})
+
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source: LocalSourceName,
+		Redirects: []api.Redirect{
+			{Id: "about", FromURL: "^/about$", ToURL: "/company/about"},
+			{Id: "contact", FromURL: "^/contact$", ToURL: "/support"},
+		},
+		Full: true,
+	}); err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+
+	for _, url := range []string{"/about", "/about", "/contact", "/missing"} {
+		rm.IndexedRedirects.Match(url)
+	}
+	if err := rm.FlushRuleHits(); err != nil {
+		t.Fatalf("Failed to flush the rule hits: %v", err)
+	}
+	rm.IndexedRedirects.Match("/about")
+	if err := rm.FlushRuleHits(); err != nil {
+		t.Fatalf("Failed to flush the rule hits: %v", err)
+	}
+
+	stored, err := rm.StoredRuleHits(true)
+	if err != nil {
+		t.Fatalf("Failed to read the rule hits: %v", err)
+	}
+	if len(stored) != 2 || stored[0].RuleId != "about" || stored[0].Hits != 3 || stored[0].Unreported != 3 || stored[1].Hits != 1 {
+		t.Fatalf("unexpected rule hits: %+v", stored)
+	}
+	if stored[0].FirstHit.IsZero() || stored[0].LastHit.Before(stored[0].FirstHit) {
+		t.Errorf("unexpected first and last hit: %+v", stored[0])
+	}
+
+	// Hits stored while uploading stay unreported
+	if err := rm.markRuleHitsReported(stored[:1]); err != nil {
+		t.Fatalf("Failed to mark the rule hits as reported: %v", err)
+	}
+	rm.IndexedRedirects.Match("/contact")
+	if err := rm.FlushRuleHits(); err != nil {
+		t.Fatalf("Failed to flush the rule hits: %v", err)
+	}
+	if unreported, _ := rm.StoredRuleHits(true); len(unreported) != 1 || unreported[0].RuleId != "contact" || unreported[0].Unreported != 2 {
+		t.Errorf("unexpected unreported rule hits: %+v", unreported)
+	}
+	if all, _ := rm.StoredRuleHits(false); len(all) != 2 || all[0].Hits != 3 || all[0].Unreported != 0 {
+		t.Errorf("unexpected rule hits: %+v", all)
+	}
+}
+
+func TestRedirectManager_RuleHitsBySource(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	rm := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db), NewCentralSource(nil)}, time.Hour, DeletionThreshold{})
+
+	// The ids of the rules are only unique within their source
+	for source, r := range map[string]api.Redirect{
+		LocalSourceName:   {Id: "1", FromURL: "^/about$", ToURL: "/company/about"},
+		CentralSourceName: {Id: "1", FromURL: "^/contact$", ToURL: "/support"},
+	} {
+		if err := rm.applyChanges(api.RedirectChanges{Source: source, Redirects: []api.Redirect{r}, Full: true}); err != nil {
+			t.Fatalf("Failed to apply changes: %v", err)
+		}
+	}
+
+	for _, url := range []string{"/about", "/about", "/contact"} {
+		rm.IndexedRedirects.Match(url)
+	}
+	if rules := rm.Rule("1", LocalSourceName); len(rules) != 1 || rules[0].Hits != 2 {
+		t.Errorf("unexpected hits of the local rule: got %+v want 2", rules)
+	}
+
+	// The hits of a removed rule are still stored, and its counter is dropped
+	if err := rm.applyChanges(api.RedirectChanges{Source: LocalSourceName, Full: true}); err != nil {
+		t.Fatalf("Failed to apply changes: %v", err)
+	}
+	if len(rm.IndexedRedirects.counters) != 1 {
+		t.Errorf("unexpected counters: %+v", rm.IndexedRedirects.counters)
+	}
+	if err := rm.FlushRuleHits(); err != nil {
+		t.Fatalf("Failed to flush the rule hits: %v", err)
+	}
+	if len(rm.IndexedRedirects.retired) != 0 {
+		t.Errorf("unexpected retired counters: %+v", rm.IndexedRedirects.retired)
+	}
+
+	stored, err := rm.StoredRuleHits(false)
+	if err != nil {
+		t.Fatalf("Failed to read the rule hits: %v", err)
+	}
+	if len(stored) != 2 || stored[0].Source != CentralSourceName || stored[0].Hits != 1 || stored[1].Source != LocalSourceName || stored[1].Hits != 2 {
+		t.Errorf("unexpected rule hits: %+v", stored)
+	}
+	if rules := rm.Rule("1", CentralSourceName); len(rules) != 1 || rules[0].Hits != 1 {
+		t.Errorf("unexpected hits of the central rule: got %+v want 1", rules)
+	}
+}
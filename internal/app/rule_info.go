@@ -0,0 +1,133 @@
+package app
+
+import (
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"log"
+	"sort"
+	"strings"
+)
+
+// The states of a redirect, only the redirects of the winning source of a pattern are indexed
+const (
+	RuleIndexed     = "indexed"
+	RuleShadowed    = "shadowed"
+	RuleQuarantined = "quarantined"
+)
+
+// RuleInfo describes a redirect of a source and whether it is indexed, to find out why a URL redirects
+type RuleInfo struct {
+	FileRedirect
+	State string `json:"state"`
+	// ShadowedBy is the source of higher precedence with a redirect for the same pattern
+	ShadowedBy       string `json:"shadowedBy,omitempty"`
+	QuarantineReason string `json:"quarantineReason,omitempty"`
+	// Hits counts the requests matched by the indexed redirect, the stored ones along with the ones not stored yet
+	Hits int64 `json:"hits"`
+}
+
+// RuleFilter selects redirects by their source and state, and by a case-insensitive search of their patterns and target
+type RuleFilter struct {
+	Source     string
+	State      string
+	FromURL    string
+	FromDomain string
+	ToURL      string
+}
+
+func (f RuleFilter) matches(info RuleInfo) bool {
+	return (f.Source == "" || info.Source == f.Source) &&
+		(f.State == "" || info.State == f.State) &&
+		containsFold(info.FromURL, f.FromURL) &&
+		containsFold(info.FromDomain, f.FromDomain) &&
+		containsFold(info.ToURL, f.ToURL)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Rules returns the redirects of all sources passing the filter, ordered by the precedence of their source and by id
+func (rm *RedirectManager) Rules(filter RuleFilter) []RuleInfo {
+	storedHits := rm.storedHitsByRule()
+
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+
+	rules := make([]RuleInfo, 0)
+	for i, set := range rm.sources {
+		start := len(rules)
+		for _, r := range set.redirects {
+			if info := rm.ruleInfo(i, r, storedHits); filter.matches(info) {
+				rules = append(rules, info)
+			}
+		}
+
+		setRules := rules[start:]
+		sort.Slice(setRules, func(a, b int) bool { return setRules[a].Id < setRules[b].Id })
+	}
+
+	return rules
+}
+
+// storedHitsByRule returns the stored hits by the source and id of a rule, the rules are listed without them when they can't be read
+func (rm *RedirectManager) storedHitsByRule() map[ruleHitsKey]int64 {
+	storedHits := make(map[ruleHitsKey]int64)
+	stored, err := rm.StoredRuleHits(false)
+	if err != nil {
+		log.Println("Error reading the stored rule hits:", err)
+	}
+	for _, hits := range stored {
+		storedHits[ruleHitsKey{Source: hits.Source, RuleId: hits.RuleId}] = hits.Hits
+	}
+
+	return storedHits
+}
+
+/*
+Rule returns the redirects with the id, of the given source or of every source having it.
+The ids are only unique within a source, so without a source there can be a redirect of every source.
+*/
+func (rm *RedirectManager) Rule(id, source string) []RuleInfo {
+	storedHits := rm.storedHitsByRule()
+
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+
+	var rules []RuleInfo
+	for i, set := range rm.sources {
+		if source != "" && set.source.Name() != source {
+			continue
+		}
+		if r, ok := set.redirects[id]; ok {
+			rules = append(rules, rm.ruleInfo(i, r, storedHits))
+		}
+	}
+
+	return rules
+}
+
+func (rm *RedirectManager) ruleInfo(setIndex int, r *api.Redirect, storedHits map[ruleHitsKey]int64) RuleInfo {
+	set := rm.sources[setIndex]
+	info := RuleInfo{
+		FileRedirect: FileRedirect{
+			Id:         r.Id,
+			FromURL:    r.FromURL,
+			FromDomain: r.FromDomain,
+			ToURL:      r.ToURL,
+			StatusCode: r.StatusCode,
+			UpdatedAt:  r.UpdatedAt,
+			Source:     set.source.Name(),
+		},
+		State: RuleIndexed,
+	}
+
+	if winner := rm.winner(ruleKey(r)); winner != setIndex {
+		info.State, info.ShadowedBy = RuleShadowed, rm.sources[winner].source.Name()
+	} else if reason, ok := set.quarantined[r.Id]; ok {
+		info.State, info.QuarantineReason = RuleQuarantined, reason
+	} else {
+		info.Hits = storedHits[ruleHitsKey{Source: info.Source, RuleId: r.Id}] + rm.IndexedRedirects.unflushedHits(info.Source, r.Id)
+	}
+
+	return info
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectManager_Rules(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	rm := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db), NewCentralSource(nil)}, time.Hour, DeletionThreshold{})
+
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "^/about$", ToURL: "/company/about"},
+			{Id: "2", FromURL: "^/broken($", ToURL: "/fixed"},
+			{Id: "3", FromURL: "^/contact$", ToURL: "/support"},
+		},
+		Full: true,
+	}); err != nil {
+		t.Fatalf("Failed to apply central changes: %v", err)
+	}
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source:    LocalSourceName,
+		Redirects: []api.Redirect{{Id: "hotfix", FromURL: "^/contact$", ToURL: "/help"}},
+		Full:      true,
+	}); err != nil {
+		t.Fatalf("Failed to apply local changes: %v", err)
+	}
+
+	// The quarantined redirect isn't indexed, it doesn't break the others
+	for i := 0; i < 2; i++ {
+		if redirectURL, _ := rm.IndexedRedirects.Match("/about"); redirectURL != "/company/about" {
+			t.Fatalf("unexpected redirect: got %v want /company/about", redirectURL)
+		}
+	}
+
+	expected := map[string]RuleInfo{
+		"hotfix": {State: RuleIndexed},
+		"1":      {State: RuleIndexed, Hits: 2},
+		"2":      {State: RuleQuarantined},
+		"3":      {State: RuleShadowed, ShadowedBy: LocalSourceName},
+	}
+	rules := rm.Rules(RuleFilter{})
+	if len(rules) != len(expected) || rules[0].Id != "hotfix" || rules[1].Id != "1" {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+	for _, info := range rules {
+		want := expected[info.Id]
+		if info.State != want.State || info.ShadowedBy != want.ShadowedBy || info.Hits != want.Hits {
+			t.Errorf("unexpected rule %s: got %+v want %+v", info.Id, info, want)
+		}
+	}
+
+	if rules := rm.Rule("2", ""); len(rules) != 1 || rules[0].QuarantineReason == "" || rules[0].Source != CentralSourceName {
+		t.Errorf("unexpected quarantined rule: %+v", rules)
+	}
+	if rules := rm.Rule("2", LocalSourceName); len(rules) != 0 {
+		t.Errorf("found the central rule in the local source: %+v", rules)
+	}
+
+	if rules := rm.Rules(RuleFilter{FromURL: "CONTACT", State: RuleShadowed}); len(rules) != 1 || rules[0].Id != "3" {
+		t.Errorf("unexpected search result: %+v", rules)
+	}
+	if rules := rm.Rules(RuleFilter{ToURL: "/help", Source: CentralSourceName}); len(rules) != 0 {
+		t.Errorf("unexpected search result: %+v", rules)
+	}
+
+	// The hits are the stored ones along with the ones not stored yet, they are kept after a restart
+	if err := rm.FlushRuleHits(); err != nil {
+		t.Fatalf("Failed to flush the rule hits: %v", err)
+	}
+	rm.IndexedRedirects.Match("/about")
+	if rules := rm.Rule("1", ""); len(rules) != 1 || rules[0].Hits != 3 {
+		t.Errorf("unexpected hits: got %+v want 3", rules)
+	}
+	restarted := NewRedirectManager(db, []RuleSource{NewLocalOverrideSource(db), NewCentralSource(nil)}, time.Hour, DeletionThreshold{})
+	restarted.PopulateMapsWithDataFromDB()
+	if rules := restarted.Rule("1", ""); len(rules) != 1 || rules[0].Hits != 2 {
+		t.Errorf("unexpected hits after a restart: got %+v want 2", rules)
+	}
+}
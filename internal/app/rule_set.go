@@ -0,0 +1,205 @@
+package app
+
+import (
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"log"
+	"sort"
+)
+
+// ruleSet holds the redirects of a single RuleSource
+type ruleSet struct {
+	source    RuleSource
+	redirects map[string]*api.Redirect
+	// byKey groups the redirects by what they match on, to resolve the precedence between the sources
+	byKey map[string][]*api.Redirect
+	// quarantined holds why the redirects that would be indexed can't be, by id
+	quarantined map[string]string
+	watermark   string
+	status      SourceStatus
+	// pending are the deletions of the source held back by the DeletionThreshold, replaced when the source syncs again
+	pending *pendingDeletions
+}
+
+func newRuleSet(source RuleSource) *ruleSet {
+	return &ruleSet{
+		source:      source,
+		redirects:   make(map[string]*api.Redirect),
+		byKey:       make(map[string][]*api.Redirect),
+		quarantined: make(map[string]string),
+	}
+}
+
+func (set *ruleSet) add(r *api.Redirect) {
+	set.redirects[r.Id] = r
+	key := ruleKey(r)
+	set.byKey[key] = append(set.byKey[key], r)
+}
+
+func (set *ruleSet) remove(id string) {
+	r, ok := set.redirects[id]
+	if !ok {
+		return
+	}
+	delete(set.redirects, id)
+	delete(set.quarantined, id)
+
+	key := ruleKey(r)
+	keyed := set.byKey[key]
+	for i, kr := range keyed {
+		if kr == r {
+			keyed = append(keyed[:i], keyed[i+1:]...)
+			break
+		}
+	}
+	if len(keyed) == 0 {
+		delete(set.byKey, key)
+	} else {
+		set.byKey[key] = keyed
+	}
+}
+
+// ruleKey identifies what a redirect matches on, the same way the IndexedRedirects tell rules apart
+func ruleKey(r *api.Redirect) string {
+	if r.FromDomain != "" {
+		return "domain:" + r.FromDomain
+	}
+
+	return "path:" + r.FromURL
+}
+
+// ruleSet returns the rule set of the named source, or nil for an unknown source
+func (rm *RedirectManager) ruleSet(source string) *ruleSet {
+	for _, set := range rm.sources {
+		if set.source.Name() == source {
+			return set
+		}
+	}
+
+	return nil
+}
+
+// winner returns the position of the first source that has a redirect for the key, or -1 if none has
+func (rm *RedirectManager) winner(key string) int {
+	for i, set := range rm.sources {
+		if len(set.byKey[key]) > 0 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+/*
+IndexedRules returns the redirects that are indexed, the ones of the winning source of every key.
+They are ordered by the precedence of their source and by id.
+*/
+func (rm *RedirectManager) IndexedRules() []api.Redirect {
+	rm.syncMu.Lock()
+	defer rm.syncMu.Unlock()
+
+	var redirects []api.Redirect
+	for i, set := range rm.sources {
+		start := len(redirects)
+		for key, keyed := range set.byKey {
+			if rm.winner(key) != i {
+				continue
+			}
+			for _, r := range keyed {
+				if _, ok := set.quarantined[r.Id]; !ok {
+					redirects = append(redirects, *r)
+				}
+			}
+		}
+
+		setRedirects := redirects[start:]
+		sort.Slice(setRedirects, func(a, b int) bool { return setRedirects[a].Id < setRedirects[b].Id })
+	}
+
+	return redirects
+}
+
+// indexKey indexes the redirects of the key, the ones that can't be indexed are quarantined instead
+func (rm *RedirectManager) indexKey(set *ruleSet, key string) {
+	for _, r := range set.byKey[key] {
+		if err := ValidateRedirect(*r); err != nil {
+			log.Printf("Quarantined redirect %s of the %s source: %v\n", r.Id, set.source.Name(), err)
+			set.quarantined[r.Id] = err.Error()
+			continue
+		}
+		rm.IndexedRedirects.indexRedirect(set.source.Name(), *r)
+	}
+}
+
+// unindexKey removes the redirects of the key from the index, along with their hit counters
+func (rm *RedirectManager) unindexKey(set *ruleSet, key string) {
+	for _, r := range set.byKey[key] {
+		if _, ok := set.quarantined[r.Id]; ok {
+			delete(set.quarantined, r.Id)
+			continue
+		}
+		rm.IndexedRedirects.Delete(r.FromURL, r.FromDomain)
+		rm.IndexedRedirects.retireCounter(set.source.Name(), r.Id)
+	}
+}
+
+/*
+applySyncPlan updates the rule set and the index with the committed changes.
+Only the redirects of the winning source of every affected key are indexed, lower precedence sources are shadowed.
+*/
+func (rm *RedirectManager) applySyncPlan(set *ruleSet, plan *syncPlan) {
+	setIndex := -1
+	for i, s := range rm.sources {
+		if s == set {
+			setIndex = i
+		}
+	}
+
+	// Remember which source won every affected key before the changes
+	var keys []string
+	winners := make(map[string]int)
+	affect := func(r *api.Redirect) {
+		key := ruleKey(r)
+		if _, ok := winners[key]; !ok {
+			winners[key] = rm.winner(key)
+			keys = append(keys, key)
+		}
+	}
+	for _, id := range plan.deleted {
+		affect(set.redirects[id])
+	}
+	for i := range plan.updated {
+		affect(set.redirects[plan.updated[i].Id])
+		affect(&plan.updated[i])
+	}
+	for i := range plan.added {
+		affect(&plan.added[i])
+	}
+
+	for _, key := range keys {
+		if winners[key] == setIndex {
+			rm.unindexKey(set, key)
+		}
+	}
+
+	for _, id := range plan.deleted {
+		set.remove(id)
+	}
+	for _, fr := range plan.updated {
+		set.remove(fr.Id)
+		set.add(&fr)
+	}
+	for _, fr := range plan.added {
+		set.add(&fr)
+	}
+
+	for _, key := range keys {
+		before, after := winners[key], rm.winner(key)
+		if before != -1 && before != setIndex && before != after {
+			rm.unindexKey(rm.sources[before], key)
+		}
+		if after != -1 && (after == setIndex || after != before) {
+			rm.indexKey(rm.sources[after], key)
+		}
+	}
+	rm.IndexedRedirects.recordIndexedRules()
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"log"
+)
+
+const (
+	CentralSourceName = "central"
+	FileSourceName    = "file"
+	LocalSourceName   = "local"
+)
+
+/*
+RuleSource provides redirects to the RedirectManager.
+The sources are merged by precedence: for the same fromURL or fromDomain, only the rules of the first source are matched.
+*/
+type RuleSource interface {
+	// Name identifies the source, it is stored with every redirect
+	Name() string
+	// FetchChanges returns the redirects changed since the watermark, an empty watermark asks for a full snapshot
+	FetchChanges(watermark string) (api.RedirectChanges, error)
+}
+
+// SubscribableSource is a RuleSource that can push its changes live
+type SubscribableSource interface {
+	RuleSource
+	Subscribe(ctx context.Context, onConnected func(), changesCh chan<- api.RedirectChanges) error
+}
+
+// CentralSource provides the redirects of the Central API
+type CentralSource struct {
+	gqlClient *api.GraphQLClient
+}
+
+func NewCentralSource(gqlClient *api.GraphQLClient) *CentralSource {
+	return &CentralSource{gqlClient: gqlClient}
+}
+
+func (cs *CentralSource) Name() string {
+	return CentralSourceName
+}
+
+func (cs *CentralSource) FetchChanges(watermark string) (api.RedirectChanges, error) {
+	changes, err := cs.gqlClient.ExecuteRedirectChangesQuery(watermark)
+	changes.Source = CentralSourceName
+
+	return changes, err
+}
+
+// Subscribe forwards the live updates of the redirectsChanged subscription, marked with this source
+func (cs *CentralSource) Subscribe(ctx context.Context, onConnected func(), changesCh chan<- api.RedirectChanges) error {
+	pushedCh := make(chan api.RedirectChanges)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for changes := range pushedCh {
+			changes.Source = CentralSourceName
+			changesCh <- changes
+		}
+	}()
+
+	err := cs.gqlClient.SubscribeRedirectsChanged(ctx, onConnected, pushedCh)
+	close(pushedCh)
+	<-done
+
+	return err
+}
+
+// LocalOverrideSource provides the redirects stored in the local_redirects table, e.g. for hotfixes
+type LocalOverrideSource struct {
+	db *sql.DB
+}
+
+func NewLocalOverrideSource(db *sql.DB) *LocalOverrideSource {
+	return &LocalOverrideSource{db: db}
+}
+
+func (ls *LocalOverrideSource) Name() string {
+	return LocalSourceName
+}
+
+// FetchChanges always returns a full snapshot, the local overrides are few and compared by content anyway
+func (ls *LocalOverrideSource) FetchChanges(string) (api.RedirectChanges, error) {
+	rows, err := ls.db.Query("SELECT id, fromURL, fromDomain, toURL, updatedAt, statusCode FROM local_redirects")
+	if err != nil {
+		return api.RedirectChanges{}, fmt.Errorf("error reading local redirects: %v", err)
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("Error closing rows:", err)
+		}
+	}()
+
+	changes := api.RedirectChanges{Source: LocalSourceName, Full: true}
+	for rows.Next() {
+		r := api.Redirect{}
+		if err := rows.Scan(&r.Id, &r.FromURL, &r.FromDomain, &r.ToURL, &r.UpdatedAt, &r.StatusCode); err != nil {
+			return api.RedirectChanges{}, fmt.Errorf("error scanning local redirects: %v", err)
+		}
+		changes.Redirects = append(changes.Redirects, r)
+	}
+
+	return changes, rows.Err()
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRulesFile = `
+redirects:
+  - fromURL: /school/assignments
+    toURL: /school/file-items
+  - id: careers
+    fromURL: /home/careers
+    toURL: /careers
+`
+
+func TestRedirectManager_SourcePrecedence(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesFile, []byte(testRulesFile), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+
+	localSource := NewLocalOverrideSource(db)
+	fileSource := NewFileSource(rulesFile)
+	rm := NewRedirectManager(db, []RuleSource{localSource, fileSource, NewCentralSource(nil)}, time.Hour, DeletionThreshold{})
+
+	sync := func(source RuleSource) {
+		changes, err := source.FetchChanges(rm.Watermark(source.Name()))
+		if err != nil {
+			t.Fatalf("Failed to fetch %s changes: %v", source.Name(), err)
+		}
+		if err := rm.applyChanges(changes); err != nil {
+			t.Fatalf("Failed to apply %s changes: %v", source.Name(), err)
+		}
+	}
+	assertMatch := func(request, expectedRedirect string) {
+		t.Helper()
+		if redirectURL, _ := rm.IndexedRedirects.Match(request); redirectURL != expectedRedirect {
+			t.Errorf("unexpected redirect for %s: got %v want %v", request, redirectURL, expectedRedirect)
+		}
+	}
+
+	if err := rm.applyChanges(api.RedirectChanges{
+		Source: CentralSourceName,
+		Redirects: []api.Redirect{
+			{Id: "1", FromURL: "/school/assignments", ToURL: "/school/items"},
+			{Id: "2", FromURL: "/home/contact", ToURL: "/contact"},
+		},
+		Full: true,
+	}); err != nil {
+		t.Fatalf("Failed to apply central changes: %v", err)
+	}
+	sync(fileSource)
+
+	// The file shadows the Central API
+	assertMatch("/school/assignments", "/school/file-items")
+	assertMatch("/home/careers", "/careers")
+	assertMatch("/home/contact", "/contact")
+
+	_, err = db.Exec(`INSERT INTO local_redirects (id, fromURL, fromDomain, toURL, updatedAt) VALUES ('hotfix', '/school/assignments', '', '/school/hotfix', ?)`, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to insert local override: %v", err)
+	}
+	sync(localSource)
+
+	// The local override shadows both
+	assertMatch("/school/assignments", "/school/hotfix")
+
+	if _, err := db.Exec(`DELETE FROM local_redirects`); err != nil {
+		t.Fatalf("Failed to delete local override: %v", err)
+	}
+	sync(localSource)
+	assertMatch("/school/assignments", "/school/file-items")
+
+	// Removing the rule from the file uncovers the Central API redirect again
+	if err := os.WriteFile(rulesFile, []byte("redirects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+	sync(fileSource)
+	assertMatch("/school/assignments", "/school/items")
+	if _, ok := rm.IndexedRedirects.Match("/home/careers"); ok {
+		t.Errorf("redirect removed from the rules file still matches")
+	}
+
+	// A restart rebuilds the same index from the database
+	restarted := NewRedirectManager(db, []RuleSource{localSource, fileSource, NewCentralSource(nil)}, time.Hour, DeletionThreshold{})
+	restarted.PopulateMapsWithDataFromDB()
+	if redirectURL, _ := restarted.IndexedRedirects.Match("/school/assignments"); redirectURL != "/school/items" {
+		t.Errorf("unexpected redirect after a restart: got %v want %v", redirectURL, "/school/items")
+	}
+}
@@ -0,0 +1,437 @@
+package app
+
+import (
+	"log"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxExamples caps the number of example requests generated from a pattern
+const maxExamples = 64
+
+// conflictAnalysisDelay debounces the analysis of the indexed rules, a burst of syncs is analyzed once
+const conflictAnalysisDelay = 2 * time.Second
+
+// The kinds of conflicts between the indexed rules
+const (
+	ConflictDuplicate = "duplicate"
+	ConflictShadowed  = "shadowed"
+	ConflictOverlap   = "overlap"
+	ConflictChain     = "chain"
+)
+
+// Conflict is a rule that doesn't redirect the way it reads, because of another rule
+type Conflict struct {
+	Kind    string `json:"kind"`
+	RuleId  string `json:"ruleId"`
+	Pattern string `json:"pattern"`
+	// OtherRuleId is the earlier rule matching first, or the rule the target of a chain redirects through
+	OtherRuleId  string `json:"otherRuleId"`
+	OtherPattern string `json:"otherPattern"`
+	// Example is a request showing the conflict
+	Example string `json:"example,omitempty"`
+}
+
+// ConflictReport holds the conflicts found after the latest change of the indexed rules
+type ConflictReport struct {
+	AnalyzedAt     time.Time  `json:"analyzedAt"`
+	RuleSetVersion int        `json:"ruleSetVersion"`
+	Conflicts      []Conflict `json:"conflicts"`
+}
+
+// Conflicts returns the conflicts found after the latest sync
+func (rm *RedirectManager) Conflicts() ConflictReport {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	return rm.conflicts
+}
+
+// scheduleConflictAnalysis requests an analysis of the indexed rules once they changed, without waiting for it
+func (rm *RedirectManager) scheduleConflictAnalysis() {
+	select {
+	case rm.analyzeTrigger <- struct{}{}:
+	default:
+	}
+}
+
+/*
+AnalyzeConflictsOnChange analyzes the indexed rules in the background after they changed, so the syncs don't wait for it.
+The changes are debounced by conflictAnalysisDelay, the analysis runs once the rules stopped changing.
+*/
+func (rm *RedirectManager) AnalyzeConflictsOnChange() {
+	for range rm.analyzeTrigger {
+		timer := time.NewTimer(conflictAnalysisDelay)
+	debounce:
+		for {
+			select {
+			case <-rm.analyzeTrigger:
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(conflictAnalysisDelay)
+			case <-timer.C:
+				break debounce
+			}
+		}
+
+		rm.analyzeConflicts()
+	}
+}
+
+// analyzeConflicts analyzes the indexed rules and stores the report, with the version of the rule set it started from
+func (rm *RedirectManager) analyzeConflicts() {
+	rm.mu.RLock()
+	ruleSetVersion := rm.status.RuleSetVersion
+	rm.mu.RUnlock()
+
+	conflicts := rm.IndexedRedirects.AnalyzeConflicts()
+	if len(conflicts) > 0 {
+		log.Printf("Found %d conflicts between the indexed rules\n", len(conflicts))
+	}
+
+	rm.mu.Lock()
+	rm.conflicts = ConflictReport{AnalyzedAt: time.Now().UTC(), RuleSetVersion: ruleSetVersion, Conflicts: conflicts}
+	rm.status.Conflicts = len(conflicts)
+	rm.mu.Unlock()
+}
+
+/*
+AnalyzeConflicts finds the rules that redirect differently than they read:
+  - duplicates of the pattern of an earlier rule, which never match
+  - path rules shadowed by an earlier rule of the same LengthMap bucket, matching every request they would match
+  - domain rules overlapping an earlier domain rule, which wins the requests both match
+  - rules redirecting to a target that is redirected again
+
+Regexps can't be compared exactly, so the rules are compared by matching the example requests generated from their patterns.
+Only the pairs of rules that can match each other's examples are compared, see candidatePairs.
+*/
+func (idx *IndexedRedirects) AnalyzeConflicts() []Conflict {
+	// The rules are copied, as the index changes the buckets in place
+	idx.mu.RLock()
+	var buckets [][]*Rule
+	for _, prefixes := range idx.LengthMap {
+		for _, rules := range prefixes {
+			buckets = append(buckets, append([]*Rule{}, rules...))
+		}
+	}
+	domainRules := append([]*Rule{}, idx.DomainRules...)
+	idx.mu.RUnlock()
+
+	conflicts := make([]Conflict, 0)
+	allRules := domainRules
+	for _, rules := range buckets {
+		conflicts = append(conflicts, compareRules(rules, false)...)
+		allRules = append(allRules, rules...)
+	}
+	conflicts = append(conflicts, compareRules(domainRules, true)...)
+	conflicts = append(conflicts, idx.chainConflicts(allRules, domainRules)...)
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Kind != conflicts[j].Kind {
+			return conflicts[i].Kind < conflicts[j].Kind
+		}
+		return conflicts[i].RuleId < conflicts[j].RuleId
+	})
+
+	return conflicts
+}
+
+// compareRules compares every rule with the earlier rules, which are matched first
+func compareRules(rules []*Rule, overlaps bool) []Conflict {
+	var conflicts []Conflict
+	examples := make([][]string, len(rules))
+	for i, rule := range rules {
+		examples[i] = ruleExamples(rule.regexp())
+	}
+
+	candidates := candidatePairs(rules, examples)
+	for i, rule := range rules {
+		for _, j := range candidates[i] {
+			earlier := rules[j]
+			conflict := Conflict{RuleId: rule.id, Pattern: rule.regexp().String(), OtherRuleId: earlier.id, OtherPattern: earlier.regexp().String()}
+			if conflict.Pattern == conflict.OtherPattern {
+				conflict.Kind = ConflictDuplicate
+				conflicts = append(conflicts, conflict)
+				break
+			}
+
+			matched := matchingExamples(earlier.regexp(), examples[i])
+			if len(matched) > 0 && len(matched) == len(examples[i]) {
+				conflict.Kind, conflict.Example = ConflictShadowed, matched[0]
+				conflicts = append(conflicts, conflict)
+				break
+			}
+			if !overlaps {
+				continue
+			}
+			if len(matched) == 0 {
+				matched = matchingExamples(rule.regexp(), examples[j])
+			}
+			if len(matched) > 0 {
+				conflict.Kind, conflict.Example = ConflictOverlap, matched[0]
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+
+	return conflicts
+}
+
+/*
+candidatePairs returns the earlier rules to compare every rule with, in their order.
+Every match of a pattern contains its required literal, so the rules are indexed by it and a rule is only compared with the rules
+whose literal is part of one of its examples, or that have one of their examples containing its literal.
+The rules without a literal are compared with every rule, and the first rule with the same pattern is always compared for duplicates.
+*/
+func candidatePairs(rules []*Rule, examples [][]string) [][]int {
+	index := newLiteralIndex(rules)
+	pairs := make([]map[int]bool, len(rules))
+	pair := func(i, j int) {
+		if i < j {
+			i, j = j, i
+		}
+		if i == j {
+			return
+		}
+		if pairs[i] == nil {
+			pairs[i] = make(map[int]bool)
+		}
+		pairs[i][j] = true
+	}
+
+	firstOfPattern := make(map[string]int)
+	for i, rule := range rules {
+		pattern := rule.regexp().String()
+		if first, ok := firstOfPattern[pattern]; ok {
+			pair(i, first)
+		} else {
+			firstOfPattern[pattern] = i
+		}
+		for _, example := range examples[i] {
+			index.find(example, func(j int) { pair(i, j) })
+		}
+	}
+
+	candidates := make([][]int, len(rules))
+	for i, earlier := range pairs {
+		for j := range earlier {
+			candidates[i] = append(candidates[i], j)
+		}
+		sort.Ints(candidates[i])
+	}
+
+	return candidates
+}
+
+// literalIndex finds the rules, by their position, whose required literal is part of a request
+type literalIndex struct {
+	rules map[string][]int
+	// prefixes holds the prefixes of the literals, to stop extending a part of the request no literal starts with
+	prefixes map[string]bool
+	// wildcards are the rules without a literal, which can match any request
+	wildcards []int
+}
+
+func newLiteralIndex(rules []*Rule) literalIndex {
+	index := literalIndex{rules: make(map[string][]int), prefixes: make(map[string]bool)}
+	for i, rule := range rules {
+		literal := requiredLiteral(rule.regexp())
+		if literal == "" {
+			index.wildcards = append(index.wildcards, i)
+			continue
+		}
+		index.rules[literal] = append(index.rules[literal], i)
+		for end := 1; end <= len(literal); end++ {
+			index.prefixes[literal[:end]] = true
+		}
+	}
+
+	return index
+}
+
+// find calls found for the rules that can match the request, a rule can be found more than once
+func (index literalIndex) find(request string, found func(rule int)) {
+	for _, rule := range index.wildcards {
+		found(rule)
+	}
+	for start := 0; start < len(request); start++ {
+		for end := start + 1; end <= len(request) && index.prefixes[request[start:end]]; end++ {
+			for _, rule := range index.rules[request[start:end]] {
+				found(rule)
+			}
+		}
+	}
+}
+
+// requiredLiteral returns the longest literal every match of a pattern contains, it is empty when there is none
+func requiredLiteral(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	parsed = parsed.Simplify()
+
+	parts := []*syntax.Regexp{parsed}
+	if parsed.Op == syntax.OpConcat {
+		parts = parsed.Sub
+	}
+
+	var longest string
+	for _, part := range parts {
+		for part.Op == syntax.OpCapture {
+			part = part.Sub[0]
+		}
+		if part.Op == syntax.OpLiteral && part.Flags&syntax.FoldCase == 0 && len(string(part.Rune)) > len(longest) {
+			longest = string(part.Rune)
+		}
+	}
+
+	return longest
+}
+
+/*
+chainConflicts finds the rules whose target, rendered for an example request, is redirected again.
+The targets are looked up like lookupURL does, with the domain rules narrowed down by their literals instead of matching them all.
+*/
+func (idx *IndexedRedirects) chainConflicts(rules, domainRules []*Rule) []Conflict {
+	domains := newLiteralIndex(domainRules)
+	lookup := func(request string) *Rule {
+		if !strings.HasPrefix(request, "http://") && !strings.HasPrefix(request, "https://") {
+			rule, _ := idx.lookup(request)
+			return rule
+		}
+
+		var candidates []int
+		domains.find(request, func(rule int) { candidates = append(candidates, rule) })
+		sort.Ints(candidates)
+		for _, candidate := range candidates {
+			if domainRules[candidate].match(request) != nil {
+				return domainRules[candidate]
+			}
+		}
+		return nil
+	}
+
+	var conflicts []Conflict
+	for _, rule := range rules {
+		examples := ruleExamples(rule.regexp())
+		if len(examples) == 0 {
+			continue
+		}
+
+		// A rule matching its own target redirects in a loop
+		target := resolveTarget(examples[0], rule.render(rule.match(examples[0])))
+		var next *Rule
+		for _, request := range urlRequests(target) {
+			if next = lookup(request); next != nil {
+				break
+			}
+		}
+		if next != nil {
+			conflicts = append(conflicts, Conflict{
+				Kind:         ConflictChain,
+				RuleId:       rule.id,
+				Pattern:      rule.regexp().String(),
+				OtherRuleId:  next.id,
+				OtherPattern: next.regexp().String(),
+				Example:      examples[0],
+			})
+		}
+	}
+
+	return conflicts
+}
+
+// regexp returns the pattern the rule is matched with
+func (rule *Rule) regexp() *regexp.Regexp {
+	if rule.isDomain {
+		return rule.fromDomain
+	}
+
+	return rule.pattern
+}
+
+// ruleExamples generates the example requests of a pattern, only the ones it actually matches are kept
+func ruleExamples(re *regexp.Regexp) []string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+
+	return matchingExamples(re, examples(parsed.Simplify()))
+}
+
+func matchingExamples(re *regexp.Regexp, examples []string) []string {
+	var matched []string
+	for _, example := range examples {
+		if re.MatchString(example) {
+			matched = append(matched, example)
+		}
+	}
+
+	return matched
+}
+
+// examples generates strings for the parts of a pattern, trying both the shortest and a longer variant of the repeats
+func examples(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return nil
+		}
+		first, last := string(re.Rune[0]), string(re.Rune[len(re.Rune)-1])
+		if first == last {
+			return []string{first}
+		}
+		return []string{first, last}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"x", "-"}
+	case syntax.OpCapture:
+		return examples(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		return append([]string{""}, examples(re.Sub[0])...)
+	case syntax.OpPlus:
+		sub := examples(re.Sub[0])
+		return append(sub, product(sub, sub)...)
+	case syntax.OpConcat:
+		concat := []string{""}
+		for _, sub := range re.Sub {
+			concat = product(concat, examples(sub))
+		}
+		return concat
+	case syntax.OpAlternate:
+		var alternates []string
+		for _, sub := range re.Sub {
+			alternates = append(alternates, examples(sub)...)
+		}
+		return capExamples(alternates)
+	default:
+		// Anchors, boundaries and empty matches don't add any text
+		return []string{""}
+	}
+}
+
+func product(prefixes, suffixes []string) []string {
+	var combined []string
+	for _, prefix := range prefixes {
+		for _, suffix := range suffixes {
+			combined = append(combined, prefix+suffix)
+		}
+	}
+
+	return capExamples(combined)
+}
+
+func capExamples(examples []string) []string {
+	if len(examples) > maxExamples {
+		return examples[:maxExamples]
+	}
+
+	return examples
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"regexp"
+	"testing"
+)
+
+func TestIndexedRedirects_AnalyzeConflicts(t *testing.T) {
+	idx := NewIndexedRedirects()
+	idx.IndexRedirect(api.Redirect{Id: "careers", FromURL: "^/careers/(.*)$", ToURL: "/jobs/$1"})
+	idx.IndexRedirect(api.Redirect{Id: "engineer", FromURL: "^/careers/engineer$", ToURL: "/jobs/engineering"})
+	idx.IndexRedirect(api.Redirect{Id: "about", FromURL: "^/about$", ToURL: "/company"})
+	idx.IndexRedirect(api.Redirect{Id: "about-copy", FromURL: "^/about$", ToURL: "/company/about"})
+	idx.IndexRedirect(api.Redirect{Id: "old", FromURL: "^/old$", ToURL: "/new"})
+	idx.IndexRedirect(api.Redirect{Id: "new", FromURL: "^/new$", ToURL: "/newest"})
+	idx.IndexRedirect(api.Redirect{Id: "a", FromURL: "^/a$", ToURL: "/b"})
+	idx.IndexRedirect(api.Redirect{Id: "b", FromURL: "^/b$", ToURL: "/a"})
+	idx.IndexRedirect(api.Redirect{Id: "domain", FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1"})
+	idx.IndexRedirect(api.Redirect{Id: "domain-http", FromDomain: `^http://old-domain\.com/shop(.*)$`, ToURL: "https://shop.com$1"})
+	idx.IndexRedirect(api.Redirect{Id: "other-domain", FromDomain: `^https?://other\.com/(.*)$`, ToURL: "https://new-domain.com/other/$1"})
+
+	expected := []Conflict{
+		{Kind: ConflictChain, RuleId: "a", OtherRuleId: "b"},
+		{Kind: ConflictChain, RuleId: "b", OtherRuleId: "a"},
+		{Kind: ConflictChain, RuleId: "old", OtherRuleId: "new"},
+		{Kind: ConflictDuplicate, RuleId: "about-copy", OtherRuleId: "about"},
+		{Kind: ConflictShadowed, RuleId: "domain-http", OtherRuleId: "domain"},
+		{Kind: ConflictShadowed, RuleId: "engineer", OtherRuleId: "careers"},
+	}
+	conflicts := idx.AnalyzeConflicts()
+	if len(conflicts) != len(expected) {
+		t.Fatalf("unexpected conflicts: %+v", conflicts)
+	}
+	for i, conflict := range conflicts {
+		if conflict.Kind != expected[i].Kind || conflict.RuleId != expected[i].RuleId || conflict.OtherRuleId != expected[i].OtherRuleId {
+			t.Errorf("unexpected conflict %d: got %+v want %+v", i, conflict, expected[i])
+		}
+	}
+	if example := conflicts[5].Example; example != "/careers/engineer" {
+		t.Errorf("unexpected example: %v", example)
+	}
+
+	// A domain rule matching only some of the requests of an earlier one overlaps it
+	idx = NewIndexedRedirects()
+	idx.IndexRedirect(api.Redirect{Id: "shop", FromDomain: `^https://old-domain\.com/shop/(.*)$`, ToURL: "https://shop.com/$1"})
+	idx.IndexRedirect(api.Redirect{Id: "domain", FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1"})
+	if conflicts := idx.AnalyzeConflicts(); len(conflicts) != 1 || conflicts[0].Kind != ConflictOverlap || conflicts[0].OtherRuleId != "shop" {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+}
+
+func TestIndexedRedirects_AnalyzeConflicts_ManyDomainRules(t *testing.T) {
+	idx := NewIndexedRedirects()
+	for i := 0; i < 2000; i++ {
+		idx.IndexRedirect(api.Redirect{Id: fmt.Sprint("site-", i), FromDomain: fmt.Sprintf(`^https?://site%d\.com/(.*)$`, i), ToURL: fmt.Sprintf("https://new-site%d.com/$1", i)})
+	}
+	idx.IndexRedirect(api.Redirect{Id: "shop", FromDomain: `^https://site7\.com/shop/(.*)$`, ToURL: "https://shop.com/$1"})
+	idx.IndexRedirect(api.Redirect{Id: "chain", FromDomain: `^https://old\.com/(.*)$`, ToURL: "https://site9.com/$1"})
+	// A rule without a literal is compared with every rule
+	idx.IndexRedirect(api.Redirect{Id: "any", FromDomain: `(?i)^HTTPS://SITE3\.COM/$`, ToURL: "https://example.com"})
+
+	expected := []Conflict{
+		{Kind: ConflictChain, RuleId: "chain", OtherRuleId: "site-9"},
+		{Kind: ConflictOverlap, RuleId: "any", OtherRuleId: "site-3"},
+		{Kind: ConflictShadowed, RuleId: "shop", OtherRuleId: "site-7"},
+	}
+	conflicts := idx.AnalyzeConflicts()
+	if len(conflicts) != len(expected) {
+		t.Fatalf("unexpected conflicts: %+v", conflicts)
+	}
+	for i, conflict := range conflicts {
+		if conflict.Kind != expected[i].Kind || conflict.RuleId != expected[i].RuleId || conflict.OtherRuleId != expected[i].OtherRuleId {
+			t.Errorf("unexpected conflict %d: got %+v want %+v", i, conflict, expected[i])
+		}
+	}
+}
+
+func TestRequiredLiteral(t *testing.T) {
+	testCases := map[string]string{
+		`^https?://old-domain\.com/(.*)$`: "://old-domain.com/",
+		`^/careers/(engineer)$`:           "/careers/",
+		`^/(blog)$`:                       "blog",
+		`old-domain.com`:                  "old-domain",
+		`(?i)^/about$`:                    "",
+		`^/(a|b)$`:                        "/",
+		`.*`:                              "",
+	}
+
+	for pattern, expected := range testCases {
+		if literal := requiredLiteral(regexp.MustCompile(pattern)); literal != expected {
+			t.Errorf("requiredLiteral(%q) = %q, want %q", pattern, literal, expected)
+		}
+	}
+}
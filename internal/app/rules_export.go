@@ -0,0 +1,139 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats, a JSON or CSV export can be imported again or used as a rules file
+const (
+	CSVFormat  = "csv"
+	JSONFormat = "json"
+)
+
+// ExportWarning is a redirect that the export format can't express, or only partly
+type ExportWarning struct {
+	Id     string
+	Reason string
+}
+
+func (w ExportWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Id, w.Reason)
+}
+
+// csvColumns are the columns of a CSV export, in the header row expected by readRulesCSV
+var csvColumns = []string{"id", "source", "fromURL", "fromDomain", "toURL", "statusCode", "updatedAt"}
+
+// LoadStoredRedirects reads the redirects of all sources from the sqlite redirects table
+func LoadStoredRedirects(db *sql.DB) ([]FileRedirect, error) {
+	rows, err := db.Query("SELECT source, id, fromURL, fromDomain, toURL, updatedAt, statusCode FROM redirects ORDER BY source, id")
+	if err != nil {
+		return nil, fmt.Errorf("error reading redirects: %v", err)
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("Error closing rows:", err)
+		}
+	}()
+
+	redirects := make([]FileRedirect, 0)
+	for rows.Next() {
+		fr := FileRedirect{}
+		if err := rows.Scan(&fr.Source, &fr.Id, &fr.FromURL, &fr.FromDomain, &fr.ToURL, &fr.UpdatedAt, &fr.StatusCode); err != nil {
+			return nil, fmt.Errorf("error scanning redirects: %v", err)
+		}
+		redirects = append(redirects, fr)
+	}
+
+	return redirects, rows.Err()
+}
+
+// ExportRedirects writes the redirects as CSV or JSON
+func ExportRedirects(w io.Writer, redirects []FileRedirect, format string) error {
+	switch format {
+	case CSVFormat:
+		return exportRedirectsCSV(w, redirects)
+	case JSONFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(RulesFile{Redirects: redirects})
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+func exportRedirectsCSV(w io.Writer, redirects []FileRedirect) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, fr := range redirects {
+		updatedAt := ""
+		if !fr.UpdatedAt.IsZero() {
+			updatedAt = fr.UpdatedAt.Format(time.RFC3339)
+		}
+		statusCode := ""
+		if fr.StatusCode != 0 {
+			statusCode = strconv.Itoa(fr.StatusCode)
+		}
+		if err := writer.Write([]string{fr.Id, fr.Source, fr.FromURL, fr.FromDomain, fr.ToURL, statusCode, updatedAt}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// schemePattern matches the scheme at the start of a domain rule, e.g. ^https?://
+var schemePattern = regexp.MustCompile(`^\^?(?:https\?|https|http)://`)
+
+/*
+splitRedirectPattern splits the pattern of a redirect into its literal host, empty for a path rule, and the
+regexp of the path without anchors. Formats matching the host and the path separately need the host to be literal.
+*/
+func splitRedirectPattern(r api.Redirect) (host string, path string, err error) {
+	pattern := r.FromURL
+	if r.FromDomain != "" {
+		loc := schemePattern.FindStringIndex(r.FromDomain)
+		if loc == nil {
+			return "", "", fmt.Errorf("the domain pattern has to start with the scheme, e.g. ^https?://")
+		}
+		rest := r.FromDomain[loc[1]:]
+		hostEnd := strings.IndexAny(rest, "/$")
+		if hostEnd == -1 {
+			hostEnd = len(rest)
+		}
+
+		var ok bool
+		if host, ok = literalSegment(rest[:hostEnd]); !ok || host == "" {
+			return "", "", fmt.Errorf("the host %q isn't literal", rest[:hostEnd])
+		}
+		pattern = rest[hostEnd:]
+		if pattern == "" {
+			pattern = "/.*"
+		}
+	}
+
+	path = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("the path pattern has to start with a slash")
+	}
+
+	return host, path, nil
+}
@@ -0,0 +1,280 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ExportLegacyRules writes the redirects as an Apache RewriteMap text file, an nginx snippet or a Netlify _redirects file,
+for sites hosted on other stacks. The redirects a format can't express are left out and returned as warnings,
+which are also listed as comments on top. Like in the plugin, the domain rules come before the path rules.
+*/
+func ExportLegacyRules(w io.Writer, redirects []api.Redirect, format string) ([]ExportWarning, error) {
+	var lines []string
+	var warnings []ExportWarning
+	switch format {
+	case ApacheFormat:
+		lines, warnings = apacheRewriteMap(domainRulesFirst(redirects))
+	case NginxFormat:
+		lines, warnings = nginxRedirectMaps(domainRulesFirst(redirects))
+	case NetlifyFormat:
+		lines, warnings = netlifyRedirects(domainRulesFirst(redirects))
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	for _, warning := range warnings {
+		if _, err := fmt.Fprintf(w, "# Not exported as it is: %s\n", warning); err != nil {
+			return warnings, err
+		}
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return warnings, err
+		}
+	}
+
+	return warnings, nil
+}
+
+/*
+apacheRewriteMap maps the exact paths, or hosts and paths, to the status code and the target of their redirect.
+RewriteMap text files only look up exact keys, so the rules with a regexp or a capture group can't be exported.
+The RewriteCond and RewriteRule directives to use the map are written as comments, a pair per status code.
+*/
+func apacheRewriteMap(redirects []api.Redirect) ([]string, []ExportWarning) {
+	var entries []string
+	var warnings []ExportWarning
+	domainStatus, pathStatus := make(map[int]bool), make(map[int]bool)
+	for _, r := range redirects {
+		host, path, ok := exactRedirect(r)
+		switch {
+		case !ok:
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: "a RewriteMap only maps exact paths"})
+			continue
+		case strings.ContainsAny(host+path+r.ToURL, " \t"):
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: "a RewriteMap key or value can't contain whitespace"})
+			continue
+		}
+
+		statusCode := redirectStatusCode(r.StatusCode)
+		if host != "" {
+			domainStatus[statusCode] = true
+		} else {
+			pathStatus[statusCode] = true
+		}
+		entries = append(entries, fmt.Sprintf("%s%s %d:%s", host, path, statusCode, r.ToURL))
+	}
+
+	lines := []string{"# RewriteMap redirects txt:/path/to/this/file"}
+	for _, statusCode := range sortedStatus(domainStatus) {
+		lines = append(lines,
+			fmt.Sprintf(`# RewriteCond ${redirects:%%{HTTP_HOST}%%{REQUEST_URI}} ^%d:(.+)$`, statusCode),
+			fmt.Sprintf("# RewriteRule ^ %%1 [R=%d,L]", statusCode))
+	}
+	for _, statusCode := range sortedStatus(pathStatus) {
+		lines = append(lines,
+			fmt.Sprintf(`# RewriteCond ${redirects:%%{REQUEST_URI}} ^%d:(.+)$`, statusCode),
+			fmt.Sprintf("# RewriteRule ^ %%1 [R=%d,L]", statusCode))
+	}
+
+	return append(lines, entries...), warnings
+}
+
+/*
+nginxRedirectMaps writes a map per status code of the domain rules on the full URL and of the path rules on $uri,
+with the returns redirecting to the map variables. The maps belong in the http block, the returns in the server blocks.
+The patterns are matched case-insensitively, as the plugin lowercases the URLs.
+*/
+func nginxRedirectMaps(redirects []api.Redirect) ([]string, []ExportWarning) {
+	var warnings []ExportWarning
+	var variables []string
+	entries := make(map[string][]string)
+	statusCodes := make(map[string]int)
+	for _, r := range redirects {
+		if nginxVariable.MatchString(r.ToURL) {
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: "a $ in the target would be taken as an nginx variable"})
+			continue
+		}
+
+		variable, pattern := fmt.Sprintf("$redirect_%d", redirectStatusCode(r.StatusCode)), r.FromURL
+		if r.FromDomain != "" {
+			variable, pattern = fmt.Sprintf("$redirect_domain_%d", redirectStatusCode(r.StatusCode)), r.FromDomain
+		}
+		if _, ok := entries[variable]; !ok {
+			variables = append(variables, variable)
+			statusCodes[variable] = redirectStatusCode(r.StatusCode)
+		}
+		entries[variable] = append(entries[variable], fmt.Sprintf("    %s %s;", nginxQuote("~*"+pattern), nginxQuote(r.ToURL)))
+	}
+
+	lines := []string{"# The maps belong in the http block, the returns in the server blocks"}
+	for _, variable := range variables {
+		source := "$uri"
+		if strings.HasPrefix(variable, "$redirect_domain_") {
+			source = "$scheme://$host$uri"
+		}
+		lines = append(lines, fmt.Sprintf("map %s %s {", source, variable))
+		lines = append(lines, entries[variable]...)
+		lines = append(lines, "}")
+	}
+	for _, variable := range variables {
+		lines = append(lines,
+			fmt.Sprintf("if (%s) {", variable),
+			fmt.Sprintf("    return %d %s;", statusCodes[variable], variable),
+			"}")
+	}
+
+	return lines, warnings
+}
+
+// netlifyRedirects writes a `from to status` line per redirect, the capture groups become placeholders or a splat
+func netlifyRedirects(redirects []api.Redirect) ([]string, []ExportWarning) {
+	var lines []string
+	var warnings []ExportWarning
+	for _, r := range redirects {
+		line, err := netlifyRule(r)
+		if err != nil {
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: err.Error()})
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, warnings
+}
+
+func netlifyRule(r api.Redirect) (string, error) {
+	host, path, err := splitRedirectPattern(r)
+	if err != nil {
+		return "", err
+	}
+	if !anchoredPattern(r) {
+		return "", fmt.Errorf("only patterns matching the whole path can be expressed")
+	}
+
+	from, placeholders, err := netlifyPath(path, host != "")
+	if err != nil {
+		return "", err
+	}
+	target := captureRef.ReplaceAllStringFunc(r.ToURL, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		if placeholder, ok := placeholders[n]; ok {
+			return placeholder
+		}
+		err = fmt.Errorf("the target references the unknown capture group %s", ref)
+		return ref
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(target, " \t") {
+		return "", fmt.Errorf("the target can't contain whitespace")
+	}
+
+	if host != "" {
+		from = "https://" + host + from
+	}
+
+	return fmt.Sprintf("%s  %s  %d", from, target, redirectStatusCode(r.StatusCode)), nil
+}
+
+/*
+netlifyPath turns the path regexp into a Netlify path, where a capture group of a whole segment becomes a :pN placeholder.
+A path rule of the plugin only matches paths with the same number of segments, so only the trailing capture
+of a domain rule, which matches the rest of the URL, becomes a splat.
+*/
+func netlifyPath(path string, splat bool) (string, map[int]string, error) {
+	if path == "(/.*)" && splat {
+		return "/*", map[int]string{1: ":splat"}, nil
+	}
+
+	placeholders := make(map[int]string)
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "(.*)" && splat && i == len(segments)-1:
+			placeholders[len(placeholders)+1] = ":splat"
+			segments[i] = "*"
+		case segment == "(.*)" || segment == "(.+)" || segment == "([^/]+)" || segment == `([^\x2F]+)`:
+			placeholder := ":p" + strconv.Itoa(len(placeholders)+1)
+			placeholders[len(placeholders)+1] = placeholder
+			segments[i] = placeholder
+		default:
+			literal, ok := literalSegment(segment)
+			if !ok || strings.HasPrefix(literal, ":") || strings.Contains(literal, "*") {
+				return "", nil, fmt.Errorf("the segment %q can't be expressed as a placeholder", segment)
+			}
+			segments[i] = literal
+		}
+	}
+
+	return strings.Join(segments, "/"), placeholders, nil
+}
+
+// exactRedirect returns the literal host, empty for a path rule, and the literal path of a redirect matching a single URL
+func exactRedirect(r api.Redirect) (string, string, bool) {
+	host, path, err := splitRedirectPattern(r)
+	if err != nil || !anchoredPattern(r) {
+		return "", "", false
+	}
+	literal, ok := literalSegment(path)
+
+	return host, literal, ok
+}
+
+// anchoredPattern reports whether the pattern of a redirect has to match the whole URL or path, a trailing (.*) matches up to the end
+func anchoredPattern(r api.Redirect) bool {
+	pattern := r.FromURL
+	if r.FromDomain != "" {
+		pattern = r.FromDomain
+	}
+
+	return strings.HasPrefix(pattern, "^") &&
+		(strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`) || strings.HasSuffix(pattern, "(.*)"))
+}
+
+// domainRulesFirst orders the domain rules before the path rules, as the plugin matches the full URL first
+func domainRulesFirst(redirects []api.Redirect) []api.Redirect {
+	ordered := make([]api.Redirect, len(redirects))
+	copy(ordered, redirects)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].FromDomain != "" && ordered[j].FromDomain == ""
+	})
+
+	return ordered
+}
+
+func sortedStatus(statusCodes map[int]bool) []int {
+	sorted := make([]int, 0, len(statusCodes))
+	for statusCode := range statusCodes {
+		sorted = append(sorted, statusCode)
+	}
+	sort.Ints(sorted)
+
+	return sorted
+}
+
+// nginxQuote quotes a map key or value, escaping the quotes and the backslashes nginx would unescape
+func nginxQuote(s string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted.WriteString(`\"`)
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"'\`, s[i+1]) != -1:
+			quoted.WriteString(`\\`)
+		default:
+			quoted.WriteByte(s[i])
+		}
+	}
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
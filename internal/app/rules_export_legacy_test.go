@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"testing"
+)
+
+var testExportRedirects = []api.Redirect{
+	{Id: "about", FromURL: "^/about$", ToURL: "/company/about", StatusCode: 301},
+	{Id: "news", FromURL: `^/news/([^\x2F]+)/([^\x2F]+)$`, ToURL: "/blog/$2?year=$1"},
+	{Id: "domain", FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1", StatusCode: 301},
+	{Id: "contact", FromDomain: `^https?://example\.com/contact$`, ToURL: "/support"},
+	{Id: "php", FromURL: `\.php$`, ToURL: "/"},
+	{Id: "shop", FromDomain: `^https?://shop\.example\.com/(.*)`, ToURL: "https://example.com/shop/$1"},
+}
+
+func TestExportLegacyRules(t *testing.T) {
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: ApacheFormat,
+			expected: `# Not exported as it is: domain: a RewriteMap only maps exact paths
+# Not exported as it is: shop: a RewriteMap only maps exact paths
+# Not exported as it is: news: a RewriteMap only maps exact paths
+# Not exported as it is: php: a RewriteMap only maps exact paths
+# RewriteMap redirects txt:/path/to/this/file
+# RewriteCond ${redirects:%{HTTP_HOST}%{REQUEST_URI}} ^302:(.+)$
+# RewriteRule ^ %1 [R=302,L]
+# RewriteCond ${redirects:%{REQUEST_URI}} ^301:(.+)$
+# RewriteRule ^ %1 [R=301,L]
+example.com/contact 302:/support
+/about 301:/company/about
+`,
+		},
+		{
+			format: NginxFormat,
+			expected: `# The maps belong in the http block, the returns in the server blocks
+map $scheme://$host$uri $redirect_domain_301 {
+    "~*^https?://old-domain\.com/(.*)$" "https://new-domain.com/$1";
+}
+map $scheme://$host$uri $redirect_domain_302 {
+    "~*^https?://example\.com/contact$" "/support";
+    "~*^https?://shop\.example\.com/(.*)" "https://example.com/shop/$1";
+}
+map $uri $redirect_301 {
+    "~*^/about$" "/company/about";
+}
+map $uri $redirect_302 {
+    "~*^/news/([^\x2F]+)/([^\x2F]+)$" "/blog/$2?year=$1";
+    "~*\.php$" "/";
+}
+if ($redirect_domain_301) {
+    return 301 $redirect_domain_301;
+}
+if ($redirect_domain_302) {
+    return 302 $redirect_domain_302;
+}
+if ($redirect_301) {
+    return 301 $redirect_301;
+}
+if ($redirect_302) {
+    return 302 $redirect_302;
+}
+`,
+		},
+		{
+			format: NetlifyFormat,
+			expected: `# Not exported as it is: php: the path pattern has to start with a slash
+https://old-domain.com/*  https://new-domain.com/:splat  301
+https://example.com/contact  /support  302
+https://shop.example.com/*  https://example.com/shop/:splat  302
+/about  /company/about  301
+/news/:p1/:p2  /blog/:p2?year=:p1  302
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := ExportLegacyRules(&buf, testExportRedirects, tc.format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("unexpected export:\n%s\nwant:\n%s", buf.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestExportLegacyRules_NetlifyRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := ExportLegacyRules(&buf, testExportRedirects, NetlifyFormat); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	redirects, convErrs := ParseNetlify(buf.Bytes())
+	if len(convErrs) != 0 {
+		t.Fatalf("unexpected conversion errors: %v", convErrs)
+	}
+
+	imported := make(map[string]api.Redirect, len(redirects))
+	for _, r := range redirects {
+		imported[ruleKey(&r)] = r
+	}
+	for _, r := range testExportRedirects[:4] {
+		got, ok := imported[ruleKey(&r)]
+		if !ok || got.ToURL != r.ToURL || got.StatusCode != redirectStatusCode(r.StatusCode) {
+			t.Errorf("redirect %s doesn't round-trip: got %+v", r.Id, got)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// traefikNoopService answers nothing, the routers only route the requests their middlewares redirect
+const traefikNoopService = "noop@internal"
+
+// TraefikConfig is a dynamic configuration of the Traefik file provider
+type TraefikConfig struct {
+	HTTP TraefikHTTPConfig `yaml:"http"`
+}
+
+type TraefikHTTPConfig struct {
+	Routers     map[string]TraefikRouter     `yaml:"routers"`
+	Middlewares map[string]TraefikMiddleware `yaml:"middlewares"`
+}
+
+type TraefikRouter struct {
+	Rule        string   `yaml:"rule"`
+	Middlewares []string `yaml:"middlewares"`
+	Service     string   `yaml:"service"`
+}
+
+type TraefikMiddleware struct {
+	RedirectRegex TraefikRedirectRegex `yaml:"redirectRegex"`
+}
+
+type TraefikRedirectRegex struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+	Permanent   bool   `yaml:"permanent"`
+}
+
+// traefikRedirect is a redirect converted into a redirectRegex middleware, with the path the router has to match
+type traefikRedirect struct {
+	name       string
+	middleware TraefikMiddleware
+	pathRegexp string
+}
+
+/*
+TraefikDynamicConfig renders the redirects as redirectRegex middlewares and a router per host, for setups without the plugin.
+The domain rules need a literal host. The path rules are routed for the given hosts, or for any host if none are given.
+A router only matches the paths of its redirects, so the other requests still reach the routers of the services.
+The plugin matches the requests in lower case, so the regexps of the routers and the middlewares ignore the case.
+*/
+func TraefikDynamicConfig(redirects []api.Redirect, hosts []string) (TraefikConfig, []ExportWarning) {
+	config := TraefikConfig{HTTP: TraefikHTTPConfig{
+		Routers:     make(map[string]TraefikRouter),
+		Middlewares: make(map[string]TraefikMiddleware),
+	}}
+	var warnings []ExportWarning
+
+	var hostOrder []string
+	byHost := make(map[string][]traefikRedirect)
+	names := newTraefikNames()
+	var pathRedirects []traefikRedirect
+	for _, r := range redirects {
+		host, path, err := splitRedirectPattern(r)
+		if err != nil {
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: err.Error()})
+			continue
+		}
+		if strings.Contains(path, "`") {
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: "a backtick can't be used in a router rule"})
+			continue
+		}
+		if r.StatusCode == http.StatusSeeOther {
+			warnings = append(warnings, ExportWarning{Id: r.Id, Reason: "a 303 can't be expressed, Traefik redirects with a 302 or 307"})
+		}
+
+		tr := traefikRedirect{middleware: traefikRedirectRegex(path, r), pathRegexp: "(?i)^" + path + "$"}
+		if host == "" {
+			tr.name = fmt.Sprintf("redirects-path-%d", len(pathRedirects)+1)
+			pathRedirects = append(pathRedirects, tr)
+			continue
+		}
+		if _, ok := byHost[host]; !ok {
+			hostOrder = append(hostOrder, host)
+		}
+		tr.name = fmt.Sprintf("redirects-%s-%d", names.of(host), len(byHost[host])+1)
+		byHost[host] = append(byHost[host], tr)
+	}
+
+	// The path rules follow the domain rules of a host, like in the plugin
+	pathHosts := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if _, ok := byHost[host]; !ok && !pathHosts[host] && len(pathRedirects) > 0 {
+			hostOrder = append(hostOrder, host)
+		}
+		pathHosts[host] = true
+	}
+	if len(hosts) == 0 && len(pathRedirects) > 0 {
+		addTraefikRouter(config, "redirects-all-hosts", "", pathRedirects)
+	}
+	for _, host := range hostOrder {
+		routed := byHost[host]
+		if pathHosts[host] {
+			routed = append(routed, pathRedirects...)
+		}
+		addTraefikRouter(config, "redirects-"+names.of(host), host, routed)
+	}
+
+	return config, warnings
+}
+
+// traefikRedirectRegex matches the full request URL, capturing the scheme and host first for relative targets
+func traefikRedirectRegex(path string, r api.Redirect) TraefikMiddleware {
+	replacement := captureRef.ReplaceAllStringFunc(r.ToURL, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		return "${" + strconv.Itoa(n+1) + "}"
+	})
+	if !strings.Contains(replacement, "://") {
+		replacement = "${1}" + replacement
+	}
+
+	return TraefikMiddleware{RedirectRegex: TraefikRedirectRegex{
+		// The URL matched by Traefik has the query string, a capture at the end of the path carries it along
+		Regex:       `(?i)^(https?://[^/]+)` + path + `(?:\?.*)?$`,
+		Replacement: replacement,
+		Permanent:   r.StatusCode == http.StatusMovedPermanently || r.StatusCode == http.StatusPermanentRedirect,
+	}}
+}
+
+func addTraefikRouter(config TraefikConfig, name, host string, redirects []traefikRedirect) {
+	var paths, middlewares []string
+	for _, tr := range redirects {
+		config.HTTP.Middlewares[tr.name] = tr.middleware
+		paths = append(paths, "PathRegexp(`"+tr.pathRegexp+"`)")
+		middlewares = append(middlewares, tr.name)
+	}
+
+	rule := strings.Join(paths, " || ")
+	if host != "" {
+		rule = "Host(`" + host + "`) && (" + rule + ")"
+	}
+	config.HTTP.Routers[name] = TraefikRouter{Rule: rule, Middlewares: middlewares, Service: traefikNoopService}
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// traefikName turns a host into a name for a router or a middleware
+func traefikName(host string) string {
+	return strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(host), "-"), "-")
+}
+
+// traefikNames gives every host a distinct name, hosts like a.b and a-b would overwrite each other's routers and middlewares
+type traefikNames struct {
+	byHost map[string]string
+	taken  map[string]bool
+}
+
+// newTraefikNames reserves the names of the path middlewares and the router of any host
+func newTraefikNames() *traefikNames {
+	return &traefikNames{byHost: make(map[string]string), taken: map[string]bool{"path": true, "all-hosts": true}}
+}
+
+// of returns the name of the host, suffixed with a number when another host already has it
+func (n *traefikNames) of(host string) string {
+	if name, ok := n.byHost[host]; ok {
+		return name
+	}
+
+	base := traefikName(host)
+	name := base
+	for i := 2; n.taken[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	n.byHost[host] = name
+	n.taken[name] = true
+
+	return name
+}
+
+// WriteTraefikConfig writes the dynamic configuration as YAML, the warnings are listed as comments on top
+func WriteTraefikConfig(w io.Writer, config TraefikConfig, warnings []ExportWarning) error {
+	for _, warning := range warnings {
+		if _, err := fmt.Fprintf(w, "# Not exported as it is: %s\n", warning); err != nil {
+			return err
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTraefikDynamicConfig(t *testing.T) {
+	redirects := []api.Redirect{
+		{Id: "domain", FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1", StatusCode: 301},
+		{Id: "careers", FromURL: "^/home/careers/(.*)$", ToURL: "/careers/$1"},
+		{Id: "about", FromURL: "^/about$", ToURL: "/company/about"},
+		{Id: "regex-host", FromDomain: `^https?://(www\.)?example\.com/`, ToURL: "https://example.org"},
+	}
+
+	config, warnings := TraefikDynamicConfig(redirects, []string{"example.com"})
+
+	if len(warnings) != 1 || warnings[0].Id != "regex-host" {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	expectedRouters := map[string]TraefikRouter{
+		"redirects-old-domain-com": {
+			Rule:        "Host(`old-domain.com`) && (PathRegexp(`(?i)^/(.*)$`))",
+			Middlewares: []string{"redirects-old-domain-com-1"},
+			Service:     traefikNoopService,
+		},
+		"redirects-example-com": {
+			Rule:        "Host(`example.com`) && (PathRegexp(`(?i)^/home/careers/(.*)$`) || PathRegexp(`(?i)^/about$`))",
+			Middlewares: []string{"redirects-path-1", "redirects-path-2"},
+			Service:     traefikNoopService,
+		},
+	}
+	if len(config.HTTP.Routers) != len(expectedRouters) {
+		t.Fatalf("unexpected routers: %+v", config.HTTP.Routers)
+	}
+	for name, expected := range expectedRouters {
+		router := config.HTTP.Routers[name]
+		if router.Rule != expected.Rule || strings.Join(router.Middlewares, ",") != strings.Join(expected.Middlewares, ",") || router.Service != expected.Service {
+			t.Errorf("unexpected router %s: got %+v want %+v", name, router, expected)
+		}
+	}
+
+	// Traefik replaces the matched request URL with the replacement
+	testCases := map[string][2]string{
+		"redirects-old-domain-com-1": {"https://old-domain.com/about?x=1", "https://new-domain.com/about?x=1"},
+		"redirects-path-1":           {"http://example.com/home/careers/engineer", "http://example.com/careers/engineer"},
+		"redirects-path-2":           {"http://example.com/about?x=1", "http://example.com/company/about"},
+	}
+	for name, tc := range testCases {
+		redirectRegex := config.HTTP.Middlewares[name].RedirectRegex
+		re := regexp.MustCompile(redirectRegex.Regex)
+		if !re.MatchString(tc[0]) {
+			t.Errorf("middleware %s doesn't match %s", name, tc[0])
+			continue
+		}
+		if redirectURL := re.ReplaceAllString(tc[0], redirectRegex.Replacement); redirectURL != tc[1] {
+			t.Errorf("unexpected redirect of middleware %s: got %v want %v", name, redirectURL, tc[1])
+		}
+	}
+	// The plugin matches the requests in lower case
+	if !regexp.MustCompile(config.HTTP.Middlewares["redirects-path-2"].RedirectRegex.Regex).MatchString("http://Example.com/About") {
+		t.Errorf("middleware redirects-path-2 doesn't ignore the case")
+	}
+	if !config.HTTP.Middlewares["redirects-old-domain-com-1"].RedirectRegex.Permanent {
+		t.Errorf("the 301 redirect isn't permanent")
+	}
+}
+
+func TestTraefikDynamicConfig_AnyHost(t *testing.T) {
+	redirects := []api.Redirect{{Id: "about", FromURL: "^/about$", ToURL: "/company/about"}}
+
+	config, _ := TraefikDynamicConfig(redirects, nil)
+
+	router, ok := config.HTTP.Routers["redirects-all-hosts"]
+	if !ok || router.Rule != "PathRegexp(`(?i)^/about$`)" {
+		t.Errorf("unexpected routers: %+v", config.HTTP.Routers)
+	}
+}
+
+func TestTraefikDynamicConfig_DistinctNames(t *testing.T) {
+	redirects := []api.Redirect{
+		{Id: "dot", FromDomain: `^https?://a\.b/(.*)$`, ToURL: "https://c.d/$1"},
+		{Id: "dash", FromDomain: `^https?://a-b/(.*)$`, ToURL: "https://e.f/$1"},
+		{Id: "about", FromURL: "^/about$", ToURL: "/company/about"},
+	}
+
+	config, _ := TraefikDynamicConfig(redirects, []string{"path", "all-hosts"})
+
+	expectedRouters := map[string]string{
+		"redirects-a-b":         "Host(`a.b`) && (PathRegexp(`(?i)^/(.*)$`))",
+		"redirects-a-b-2":       "Host(`a-b`) && (PathRegexp(`(?i)^/(.*)$`))",
+		"redirects-path-2":      "Host(`path`) && (PathRegexp(`(?i)^/about$`))",
+		"redirects-all-hosts-2": "Host(`all-hosts`) && (PathRegexp(`(?i)^/about$`))",
+	}
+	if len(config.HTTP.Routers) != len(expectedRouters) {
+		t.Fatalf("unexpected routers: %+v", config.HTTP.Routers)
+	}
+	for name, rule := range expectedRouters {
+		if router := config.HTTP.Routers[name]; router.Rule != rule {
+			t.Errorf("unexpected router %s: got %+v want %v", name, router, rule)
+		}
+	}
+
+	if len(config.HTTP.Middlewares) != 3 || config.HTTP.Middlewares["redirects-a-b-2-1"].RedirectRegex.Replacement != "https://e.f/${2}" {
+		t.Errorf("unexpected middlewares: %+v", config.HTTP.Middlewares)
+	}
+}
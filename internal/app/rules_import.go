@@ -0,0 +1,127 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// RowError is a rule of an imported file that can't be indexed, the row counts the rules from 1
+type RowError struct {
+	Row int
+	Id  string
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d (%s): %v", e.Row, e.Id, e.Err)
+}
+
+// ValidateRedirect checks that the redirect can be indexed, the patterns are compiled the same way as by IndexRule
+func ValidateRedirect(r api.Redirect) error {
+	if r.FromURL == "" && r.FromDomain == "" {
+		return fmt.Errorf("either fromURL or fromDomain is required")
+	}
+	if r.ToURL == "" {
+		return fmt.Errorf("toURL is required")
+	}
+	if r.StatusCode != 0 && !IsRedirectStatus(r.StatusCode) {
+		return fmt.Errorf("status code %d is not a redirect", r.StatusCode)
+	}
+	if _, err := regexp.Compile(r.FromURL); err != nil {
+		return fmt.Errorf("invalid fromURL: %v", err)
+	}
+	if _, err := regexp.Compile(r.FromDomain); err != nil {
+		return fmt.Errorf("invalid fromDomain: %v", err)
+	}
+
+	return nil
+}
+
+// IsRedirectStatus reports whether the status code redirects to the Location of the response
+func IsRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// redirectStatusCode is the status code of a redirect, a 302 unless the rule has one
+func redirectStatusCode(statusCode int) int {
+	if statusCode == 0 {
+		return http.StatusFound
+	}
+
+	return statusCode
+}
+
+// ValidateRedirects returns an error for every redirect that can't be indexed or reuses the id of an earlier row
+func ValidateRedirects(redirects []api.Redirect) []RowError {
+	var rowErrors []RowError
+	rows := make(map[string]int, len(redirects))
+	for i, r := range redirects {
+		row := i + 1
+		if err := ValidateRedirect(r); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Id: r.Id, Err: err})
+		} else if first, ok := rows[r.Id]; ok {
+			rowErrors = append(rowErrors, RowError{Row: row, Id: r.Id, Err: fmt.Errorf("duplicate id of row %d", first)})
+		}
+		if _, ok := rows[r.Id]; !ok {
+			rows[r.Id] = row
+		}
+	}
+
+	return rowErrors
+}
+
+/*
+ImportLocalRedirects stores the redirects as local overrides in a single transaction, existing ids are replaced.
+The running app picks them up with the next sync of the local source.
+*/
+func ImportLocalRedirects(db *sql.DB, redirects []api.Redirect) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := storeLocalRedirects(tx, redirects); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Println("Error rolling back the import transaction:", rollbackErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func storeLocalRedirects(tx *sql.Tx, redirects []api.Redirect) error {
+	stmt, err := tx.Prepare(`
+			INSERT INTO local_redirects (id, fromURL, fromDomain, toURL, updatedAt, statusCode)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE
+			SET fromURL = EXCLUDED.fromURL, fromDomain = EXCLUDED.fromDomain, toURL = EXCLUDED.toURL,
+			    updatedAt = EXCLUDED.updatedAt, statusCode = EXCLUDED.statusCode;
+			`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, r := range redirects {
+		if r.UpdatedAt.IsZero() {
+			r.UpdatedAt = now
+		}
+		if _, err := stmt.Exec(r.Id, r.FromURL, r.FromDomain, r.ToURL, r.UpdatedAt, r.StatusCode); err != nil {
+			return fmt.Errorf("error storing redirect %s: %v", r.Id, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// serverVariable matches the %{VAR} server variables and %n RewriteCond backreferences of Apache
+var serverVariable = regexp.MustCompile(`%\{[^}]*\}|%\d`)
+
+// rewriteCond is a RewriteCond applying to the next RewriteRule
+type rewriteCond struct {
+	line    int
+	text    string
+	test    string
+	pattern string
+}
+
+/*
+ParseHtaccess converts the Redirect, RedirectMatch and RewriteRule directives of an Apache .htaccess file.
+A RewriteRule only converts when it redirects, a preceding HTTP_HOST RewriteCond turns it into a domain rule.
+Redirect is a prefix match, it converts into a redirect of the exact path and one of the paths below it.
+The NC flag of a RewriteRule is dropped with a warning, the requests are matched in lower case.
+*/
+func ParseHtaccess(content []byte) ([]api.Redirect, []ConversionError) {
+	c := &legacyConverter{}
+	var conds []rewriteCond
+	base := "/"
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		fields := splitFields(strings.TrimSpace(text))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch directive := strings.ToLower(fields[0]); directive {
+		case "redirect", "redirectpermanent", "redirecttemp":
+			r, err := convertRedirectDirective(directive, fields[1:])
+			converted := len(c.redirects)
+			c.add(line, text, r, err)
+
+			// Apache redirects the paths below the path as well, appending the rest of the path to the target
+			if len(c.redirects) > converted {
+				path := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(r.FromURL, "^"), "$"), "/")
+				below, err := pathRedirect("^"+path+"/(.*)$", strings.TrimSuffix(r.ToURL, "/")+"/$1", r.StatusCode)
+				c.add(line, text, below, err)
+			}
+		case "redirectmatch":
+			r, err := convertRedirectMatch(fields[1:])
+			c.add(line, text, r, err)
+		case "rewritecond":
+			if len(fields) < 3 {
+				c.fail(line, text, fmt.Errorf("incomplete RewriteCond"))
+				continue
+			}
+			conds = append(conds, rewriteCond{line: line, text: text, test: fields[1], pattern: fields[2]})
+		case "rewriterule":
+			r, err := convertRewriteRule(fields[1:], conds, base)
+			converted := len(c.redirects)
+			c.add(line, text, r, err)
+			if len(c.redirects) > converted && len(fields) > 3 && hasRewriteFlag(fields[3], "nc", "nocase") {
+				c.warn(line, text, "the NC flag is dropped, the requests are matched in lower case so only a lowercase pattern matches any case")
+			}
+			conds = nil
+		case "rewritebase":
+			if len(fields) > 1 {
+				base = strings.TrimSuffix(fields[1], "/") + "/"
+			}
+		}
+	}
+
+	return c.result()
+}
+
+// apacheStatus parses the status of a Redirect directive, e.g. permanent or 301
+func apacheStatus(status string) (int, error) {
+	switch strings.ToLower(status) {
+	case "permanent":
+		return http.StatusMovedPermanently, nil
+	case "temp":
+		return http.StatusFound, nil
+	case "seeother":
+		return http.StatusSeeOther, nil
+	case "gone":
+		return 0, fmt.Errorf("status code %d is not a redirect", http.StatusGone)
+	}
+
+	return redirectStatus(status)
+}
+
+func isApacheStatus(field string) bool {
+	switch strings.ToLower(field) {
+	case "permanent", "temp", "seeother", "gone":
+		return true
+	}
+
+	return len(field) == 3 && field[0] >= '0' && field[0] <= '9'
+}
+
+// convertRedirectDirective converts `Redirect [status] /path url`, RedirectPermanent and RedirectTemp
+func convertRedirectDirective(directive string, args []string) (api.Redirect, error) {
+	statusCode := http.StatusFound
+	if directive == "redirectpermanent" {
+		statusCode = http.StatusMovedPermanently
+	}
+	if directive == "redirect" && len(args) > 0 && isApacheStatus(args[0]) {
+		var err error
+		if statusCode, err = apacheStatus(args[0]); err != nil {
+			return api.Redirect{}, err
+		}
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return api.Redirect{}, fmt.Errorf("expected a path and a target URL")
+	}
+	if !strings.HasPrefix(args[0], "/") {
+		return api.Redirect{}, fmt.Errorf("the path %q has to start with a slash", args[0])
+	}
+
+	return pathRedirect(exactPath(args[0]), args[1], statusCode)
+}
+
+// convertRedirectMatch converts `RedirectMatch [status] regex url`
+func convertRedirectMatch(args []string) (api.Redirect, error) {
+	statusCode := http.StatusFound
+	if len(args) > 0 && isApacheStatus(args[0]) {
+		var err error
+		if statusCode, err = apacheStatus(args[0]); err != nil {
+			return api.Redirect{}, err
+		}
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return api.Redirect{}, fmt.Errorf("expected a pattern and a target URL")
+	}
+
+	return pathRedirect(args[0], args[1], statusCode)
+}
+
+// hasRewriteFlag reports whether the [flags] of a RewriteRule contain one of the names
+func hasRewriteFlag(flags string, names ...string) bool {
+	for _, flag := range strings.Split(strings.Trim(flags, "[]"), ",") {
+		name, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(flag)), "=")
+		for _, n := range names {
+			if name == n {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+convertRewriteRule converts `RewriteRule pattern substitution [flags]`, the pattern of an .htaccess doesn't start with a slash.
+Only rules with the R flag or an absolute substitution redirect, the others rewrite internally.
+*/
+func convertRewriteRule(args []string, conds []rewriteCond, base string) (api.Redirect, error) {
+	if len(args) < 2 {
+		return api.Redirect{}, fmt.Errorf("expected a pattern and a substitution")
+	}
+	pattern, target := args[0], args[1]
+	absolute := strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+
+	statusCode := 0
+	if len(args) > 2 {
+		for _, flag := range strings.Split(strings.Trim(args[2], "[]"), ",") {
+			name, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(flag)), "=")
+			switch name {
+			case "r", "redirect":
+				statusCode = http.StatusFound
+				if value != "" {
+					var err error
+					if statusCode, err = apacheStatus(value); err != nil {
+						return api.Redirect{}, err
+					}
+				}
+			case "f", "forbidden":
+				return api.Redirect{}, fmt.Errorf("status code %d is not a redirect", http.StatusForbidden)
+			case "g", "gone":
+				return api.Redirect{}, fmt.Errorf("status code %d is not a redirect", http.StatusGone)
+			}
+		}
+	}
+	if statusCode == 0 {
+		if !absolute {
+			return api.Redirect{}, fmt.Errorf("internal rewrite, not a redirect")
+		}
+		statusCode = http.StatusFound
+	}
+
+	if target == "-" {
+		return api.Redirect{}, fmt.Errorf("no substitution to redirect to")
+	}
+	if serverVariable.MatchString(target) {
+		return api.Redirect{}, fmt.Errorf("server variables and RewriteCond backreferences can't be converted")
+	}
+	// A trailing question mark only drops the query string
+	target = strings.TrimSuffix(target, "?")
+	if !absolute && !strings.HasPrefix(target, "/") {
+		target = base + target
+	}
+
+	var hostPattern string
+	for _, cond := range conds {
+		if !strings.EqualFold(cond.test, "%{HTTP_HOST}") || strings.HasPrefix(cond.pattern, "!") || hostPattern != "" {
+			return api.Redirect{}, fmt.Errorf("the RewriteCond on line %d can't be converted", cond.line)
+		}
+		hostPattern = cond.pattern
+	}
+
+	// The pattern of an .htaccess is matched without the leading slash
+	if strings.HasPrefix(pattern, "^") && !strings.HasPrefix(pattern, "^/") {
+		pattern = "^/" + pattern[1:]
+	}
+	if hostPattern != "" {
+		if !strings.HasPrefix(pattern, "^") {
+			pattern = "/.*?" + pattern
+		}
+		return domainRedirect(hostPattern, pattern, target, statusCode)
+	}
+
+	return pathRedirect(pattern, target, statusCode)
+}
@@ -0,0 +1,343 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Legacy config formats whose redirects can be imported
+const (
+	ApacheFormat  = "apache"
+	NginxFormat   = "nginx"
+	NetlifyFormat = "netlify"
+)
+
+// ConversionError is a line of a legacy config that can't be converted into a redirect, or a warning about a converted line
+type ConversionError struct {
+	Line   int
+	Text   string
+	Reason string
+	// Warning is set when the line was converted, but its redirect doesn't match every request the line did
+	Warning bool
+}
+
+func (e ConversionError) Error() string {
+	if e.Warning {
+		return fmt.Sprintf("line %d: warning: %s: %s", e.Line, e.Reason, e.Text)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Reason, e.Text)
+}
+
+// LegacyFormat detects the legacy config format by the file name, it returns "" for the rules file formats
+func LegacyFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".htaccess"):
+		return ApacheFormat
+	case name == "_redirects":
+		return NetlifyFormat
+	case strings.HasSuffix(name, ".conf"):
+		return NginxFormat
+	}
+
+	return ""
+}
+
+// ReadLegacyRulesFile converts the redirects of an Apache, nginx or Netlify config, skipping the lines that can't be converted
+func ReadLegacyRulesFile(path, format string) ([]api.Redirect, []ConversionError, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	switch format {
+	case ApacheFormat:
+		redirects, convErrs := ParseHtaccess(content)
+		return redirects, convErrs, nil
+	case NginxFormat:
+		redirects, convErrs := ParseNginx(content)
+		return redirects, convErrs, nil
+	case NetlifyFormat:
+		redirects, convErrs := ParseNetlify(content)
+		return redirects, convErrs, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported legacy format: %s", format)
+	}
+}
+
+// legacyConverter collects the redirects converted from a legacy config and the lines that failed
+type legacyConverter struct {
+	redirects []api.Redirect
+	errors    []ConversionError
+}
+
+// result returns the converted redirects and the errors in the order of the lines
+func (c *legacyConverter) result() ([]api.Redirect, []ConversionError) {
+	sort.SliceStable(c.errors, func(i, j int) bool { return c.errors[i].Line < c.errors[j].Line })
+	return c.redirects, c.errors
+}
+
+// add records the outcome of converting a line, the redirect has to be valid for the index as well
+func (c *legacyConverter) add(line int, text string, r api.Redirect, err error) {
+	if err == nil {
+		err = ValidateRedirect(r)
+	}
+	if err != nil {
+		c.fail(line, text, err)
+		return
+	}
+
+	r.Id = ruleKey(&r)
+	c.redirects = append(c.redirects, r)
+
+	if r.FromDomain == "" && spansSegments(r.FromURL) {
+		c.warn(line, text, fmt.Sprintf("%s only matches paths with as many segments as the pattern, not the deeper paths the rule matched", r.FromURL))
+	}
+}
+
+// warn records a line that converted into a redirect behaving differently from the original rule
+func (c *legacyConverter) warn(line int, text string, reason string) {
+	c.errors = append(c.errors, ConversionError{Line: line, Text: strings.TrimSpace(text), Reason: reason, Warning: true})
+}
+
+func (c *legacyConverter) fail(line int, text string, err error) {
+	c.errors = append(c.errors, ConversionError{Line: line, Text: strings.TrimSpace(text), Reason: err.Error()})
+}
+
+// pathRedirect converts a path pattern, anchored to the start of the path, into a redirect
+func pathRedirect(pattern, target string, statusCode int) (api.Redirect, error) {
+	fromURL, err := indexablePath(pattern)
+	if err != nil {
+		return api.Redirect{}, err
+	}
+
+	return api.Redirect{FromURL: fromURL, ToURL: target, StatusCode: statusCode}, nil
+}
+
+/*
+domainRedirect converts a host and a path pattern into a redirect matching the full request URLs, the path starts with a slash.
+The captures of the host pattern come first, so the $n of a target only referring to the path are shifted.
+*/
+func domainRedirect(hostPattern, pathPattern, target string, statusCode int) (api.Redirect, error) {
+	host := strings.TrimSuffix(strings.TrimPrefix(hostPattern, "^"), "$")
+	re, err := regexp.Compile(host)
+	if err != nil {
+		return api.Redirect{}, fmt.Errorf("invalid host pattern: %v", err)
+	}
+
+	return api.Redirect{
+		FromDomain: "^https?://" + host + strings.TrimPrefix(pathPattern, "^"),
+		ToURL:      shiftCaptures(target, re.NumSubexp()),
+		StatusCode: statusCode,
+	}, nil
+}
+
+var captureRef = regexp.MustCompile(`\$(\d+)`)
+
+func shiftCaptures(target string, shift int) string {
+	if shift == 0 {
+		return target
+	}
+
+	return captureRef.ReplaceAllStringFunc(target, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		return "$" + strconv.Itoa(n+shift)
+	})
+}
+
+// exactPath returns the pattern matching only the given path
+func exactPath(path string) string {
+	return "^" + regexp.QuoteMeta(path) + "$"
+}
+
+/*
+indexablePath adapts a path pattern to the IndexedRedirects, which group the path rules by their number of segments and first segment.
+The first segment has to be literal, it is unescaped so it equals the first segment of the requests it matches.
+*/
+func indexablePath(pattern string) (string, error) {
+	anchor := ""
+	if strings.HasPrefix(pattern, "^") {
+		anchor, pattern = "^", pattern[1:]
+	} else if !strings.HasPrefix(pattern, "/") {
+		return "", fmt.Errorf("the pattern %q matches anywhere in the path, only patterns matching from the start can be indexed", pattern)
+	}
+
+	first, rest, hasRest := strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+	end := ""
+	if !hasRest && strings.HasSuffix(first, "$") && !strings.HasSuffix(first, `\$`) {
+		first, end = strings.TrimSuffix(first, "$"), "$"
+	}
+
+	literal, ok := literalSegment(first)
+	if !ok {
+		return "", fmt.Errorf("the first path segment %q has to be literal to be indexed", first)
+	}
+
+	path := anchor + "/" + literal + end
+	if hasRest {
+		path += "/" + escapeClassSlashes(rest)
+	}
+
+	return path, nil
+}
+
+/*
+spansSegments tells whether an indexable path pattern can match more path segments than it has, e.g. through .* or a missing $.
+The IndexedRedirects only match a path rule against the paths with its number of segments, so it misses the deeper paths.
+*/
+func spansSegments(pattern string) bool {
+	if !strings.HasSuffix(pattern, "$") || strings.HasSuffix(pattern, `\$`) {
+		return true
+	}
+
+	_, rest, hasRest := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(pattern, "^"), "/"), "/")
+	if !hasRest {
+		return false
+	}
+	re, err := syntax.Parse(rest, syntax.Perl)
+	if err != nil {
+		return true
+	}
+
+	return canMatchSlash(re, false)
+}
+
+// canMatchSlash tells whether the regexp can match a slash, or a varying number of them when its literal slashes are repeated
+func canMatchSlash(re *syntax.Regexp, repeated bool) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '/' && '/' <= re.Rune[i+1] {
+				return true
+			}
+		}
+	case syntax.OpLiteral:
+		return repeated && strings.ContainsRune(string(re.Rune), '/')
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat, syntax.OpAlternate:
+		repeated = true
+	}
+
+	for _, sub := range re.Sub {
+		if canMatchSlash(sub, repeated) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escapeClassSlashes escapes the slashes of the character classes, e.g. [^/], which would otherwise count as segments
+func escapeClassSlashes(pattern string) string {
+	var escaped strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '\\' && i+1 < len(pattern):
+			escaped.WriteString(pattern[i : i+2])
+			i++
+		case ch == '[':
+			inClass = true
+			escaped.WriteByte(ch)
+		case ch == ']':
+			inClass = false
+			escaped.WriteByte(ch)
+		case ch == '/' && inClass:
+			escaped.WriteString(`\x2F`)
+		default:
+			escaped.WriteByte(ch)
+		}
+	}
+
+	return escaped.String()
+}
+
+// literalSegment returns the text matched by a literal pattern, an unescaped dot is taken as a literal dot
+func literalSegment(segment string) (string, bool) {
+	re, err := syntax.Parse(segment, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	nodes := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		nodes = re.Sub
+	}
+
+	var literal strings.Builder
+	for _, node := range nodes {
+		switch node.Op {
+		case syntax.OpEmptyMatch:
+		case syntax.OpLiteral:
+			if node.Flags&syntax.FoldCase != 0 {
+				return "", false
+			}
+			literal.WriteString(string(node.Rune))
+		case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+			literal.WriteString(".")
+		default:
+			return "", false
+		}
+	}
+
+	// The literal stays part of the pattern, so it can't contain any regexp syntax besides the dots
+	text := literal.String()
+	if regexp.QuoteMeta(text) != strings.ReplaceAll(text, ".", `\.`) {
+		return "", false
+	}
+
+	return text, true
+}
+
+// redirectStatus parses a numeric status code, which has to be a redirect
+func redirectStatus(code string) (int, error) {
+	statusCode, err := strconv.Atoi(code)
+	if err != nil {
+		return 0, fmt.Errorf("invalid status code %q", code)
+	}
+	if !IsRedirectStatus(statusCode) {
+		return 0, fmt.Errorf("status code %d is not a redirect", statusCode)
+	}
+
+	return statusCode, nil
+}
+
+// splitFields splits a config line on whitespace, keeping double-quoted fields together
+func splitFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inField, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '"':
+			quoted = !quoted
+			inField = true
+		case ch == '\\' && quoted && i+1 < len(line) && line[i+1] == '"':
+			field.WriteByte('"')
+			i++
+		case (ch == ' ' || ch == '\t') && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteByte(ch)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields
+}
@@ -0,0 +1,231 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"testing"
+)
+
+const testHtaccess = `
+RewriteEngine On
+Redirect 301 /old.html /new.html
+RedirectMatch permanent ^/blog/(\d+)/(.*)$ /news/$2?id=$1
+RewriteRule ^careers/(.*)$ /jobs/$1 [R=301,NC,L]
+RewriteCond %{HTTP_HOST} ^(www\.)?old-domain\.com$ [NC]
+RewriteRule ^(.*)$ https://new-domain.com/$1 [R=302,L]
+RewriteRule ^index\.php$ /home [L]
+RewriteCond %{HTTPS} off
+RewriteRule (.*) https://%{HTTP_HOST}/$1 [R=301,L]
+Redirect gone /removed
+`
+
+const testNginx = `
+map $uri $new_uri {
+    default "";
+    /promo /sale;
+    ~^/shop/(?<item>[a-z]+)$ /store/$item;
+}
+
+server {
+    server_name old-domain.com;
+    return 301 https://new-domain.com$request_uri;
+}
+
+server {
+    server_name example.com;
+    if ($new_uri) {
+        return 301 $new_uri;
+    }
+    rewrite ^/about-us$ /about permanent;
+    rewrite ^/app/(.*)$ /index.php?path=$1 last;
+    location = /contact {
+        return 302 /support;
+    }
+    location ~ ^/docs/(.*)$ {
+        return 301 $scheme://docs.example.com/$1;
+    }
+}
+`
+
+const testNetlify = `
+# Netlify redirects
+/home              /
+/news/:year/:slug  /blog/:slug?year=:year
+/assets/*          /static/:splat  302
+https://old-domain.com/*  https://new-domain.com/:splat  301!
+/app/*             /index.html  200
+/store id=:id      /products/:id
+`
+
+func TestParseLegacyRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		parse    func([]byte) ([]api.Redirect, []ConversionError)
+		content  string
+		expected []api.Redirect
+		errLines []int
+		// warnLines are the lines converted into redirects missing the deeper paths or ignoring the case
+		warnLines []int
+		// matches are requests and their expected redirects through the index
+		matches map[string]string
+	}{
+		{
+			name:    "Apache",
+			parse:   ParseHtaccess,
+			content: testHtaccess,
+			expected: []api.Redirect{
+				{FromURL: `^/old.html$`, ToURL: "/new.html", StatusCode: 301},
+				{FromURL: `^/old.html/(.*)$`, ToURL: "/new.html/$1", StatusCode: 301},
+				{FromURL: `^/blog/(\d+)/(.*)$`, ToURL: "/news/$2?id=$1", StatusCode: 301},
+				{FromURL: `^/careers/(.*)$`, ToURL: "/jobs/$1", StatusCode: 301},
+				{FromDomain: `^https?://(www\.)?old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$2", StatusCode: 302},
+			},
+			errLines:  []int{8, 10, 11},
+			warnLines: []int{3, 4, 5, 5},
+			matches: map[string]string{
+				"/old.html":                    "/new.html",
+				"/old.html/page":               "/new.html/page",
+				"/blog/2024/hello":             "/news/hello?id=2024",
+				"/careers/engineer":            "/jobs/engineer",
+				"https://www.old-domain.com/x": "https://new-domain.com/x",
+			},
+		},
+		{
+			name:    "nginx",
+			parse:   ParseNginx,
+			content: testNginx,
+			expected: []api.Redirect{
+				{FromDomain: `^https?://old-domain\.com(/.*)$`, ToURL: "https://new-domain.com$1", StatusCode: 301},
+				{FromURL: `^/about-us$`, ToURL: "/about", StatusCode: 301},
+				{FromURL: `^/contact$`, ToURL: "/support", StatusCode: 302},
+				{FromURL: `^/promo$`, ToURL: "/sale", StatusCode: 301},
+				{FromURL: `^/shop/(?<item>[a-z]+)$`, ToURL: "/store/$1", StatusCode: 301},
+			},
+			errLines: []int{19, 24},
+			matches: map[string]string{
+				"https://old-domain.com/a/b": "https://new-domain.com/a/b",
+				"/about-us":                  "/about",
+				"/contact":                   "/support",
+				"/promo":                     "/sale",
+				"/shop/shoes":                "/store/shoes",
+			},
+		},
+		{
+			name:    "Netlify",
+			parse:   ParseNetlify,
+			content: testNetlify,
+			expected: []api.Redirect{
+				{FromURL: `^/home$`, ToURL: "/", StatusCode: 301},
+				{FromURL: `^/home/$`, ToURL: "/", StatusCode: 301},
+				{FromURL: `^/news/([^\x2F]+)/([^\x2F]+)$`, ToURL: "/blog/$2?year=$1", StatusCode: 301},
+				{FromURL: `^/news/([^\x2F]+)/([^\x2F]+)/$`, ToURL: "/blog/$2?year=$1", StatusCode: 301},
+				{FromURL: `^/assets/(.*)$`, ToURL: "/static/$1", StatusCode: 302},
+				{FromDomain: `^https?://old-domain\.com/(.*)$`, ToURL: "https://new-domain.com/$1", StatusCode: 301},
+			},
+			errLines:  []int{7, 8},
+			warnLines: []int{5},
+			matches: map[string]string{
+				"/home":                        "/",
+				"/home/":                       "/",
+				"/news/2024/hello":             "/blog/hello?year=2024",
+				"/assets/logo.png":             "/static/logo.png",
+				"https://old-domain.com/about": "https://new-domain.com/about",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redirects, convErrs := tc.parse([]byte(tc.content))
+
+			if len(redirects) != len(tc.expected) {
+				t.Fatalf("unexpected redirects: got %+v want %+v", redirects, tc.expected)
+			}
+			for i, r := range redirects {
+				expected := tc.expected[i]
+				expected.Id = ruleKey(&expected)
+				if r != expected {
+					t.Errorf("unexpected redirect: got %+v want %+v", r, expected)
+				}
+			}
+
+			var errLines, warnLines []int
+			for _, convErr := range convErrs {
+				if convErr.Warning {
+					warnLines = append(warnLines, convErr.Line)
+				} else {
+					errLines = append(errLines, convErr.Line)
+				}
+			}
+			if fmt.Sprint(errLines) != fmt.Sprint(tc.errLines) || fmt.Sprint(warnLines) != fmt.Sprint(tc.warnLines) {
+				t.Errorf("unexpected conversion errors: got %v want errors on lines %v and warnings on lines %v", convErrs, tc.errLines, tc.warnLines)
+			}
+
+			idx := NewIndexedRedirects()
+			for _, r := range redirects {
+				idx.IndexRule(r.FromURL, r.FromDomain, r.ToURL)
+			}
+			for request, expectedRedirect := range tc.matches {
+				if redirectURL, _ := idx.Match(request); redirectURL != expectedRedirect {
+					t.Errorf("unexpected redirect for %s: got %v want %v", request, redirectURL, expectedRedirect)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexablePath(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected string
+		ok       bool
+	}{
+		{pattern: `^/old\.html$`, expected: `^/old.html$`, ok: true},
+		{pattern: `/blog/(.*)`, expected: `/blog/(.*)`, ok: true},
+		{pattern: `^/blog/([^/]+)$`, expected: `^/blog/([^\x2F]+)$`, ok: true},
+		{pattern: `^/$`, expected: `^/$`, ok: true},
+		{pattern: `^/(en|nl)/about$`, ok: false},
+		{pattern: `^/a\+b$`, ok: false},
+		{pattern: `\.php$`, ok: false},
+	}
+
+	for _, tc := range testCases {
+		path, err := indexablePath(tc.pattern)
+		if (err == nil) != tc.ok || path != tc.expected {
+			t.Errorf("unexpected indexable path of %s: got %q, %v want %q", tc.pattern, path, err, tc.expected)
+		}
+	}
+}
+
+func TestSpansSegments(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected bool
+	}{
+		{pattern: `^/old.html$`, expected: false},
+		{pattern: `^/blog/([^\x2F]+)$`, expected: false},
+		{pattern: `^/shop/(?<item>[a-z]+)$`, expected: false},
+		{pattern: `^/blog/(.*)$`, expected: true},
+		{pattern: `^/blog/(\d+)/(.*)$`, expected: true},
+		{pattern: `^/docs/([a-z/]+)$`, expected: true},
+		{pattern: `^/docs/(a/)+b$`, expected: true},
+		{pattern: `^/old`, expected: true},
+	}
+
+	for _, tc := range testCases {
+		if spans := spansSegments(tc.pattern); spans != tc.expected {
+			t.Errorf("unexpected spansSegments of %s: got %v want %v", tc.pattern, spans, tc.expected)
+		}
+	}
+}
+
+func TestParseNginx_WarnsAboutDeeperPaths(t *testing.T) {
+	redirects, convErrs := ParseNginx([]byte(`rewrite ^/blog/(.*)$ /news/$1 permanent;`))
+
+	if len(redirects) != 1 {
+		t.Fatalf("unexpected redirects: %+v", redirects)
+	}
+	if len(convErrs) != 1 || !convErrs[0].Warning {
+		t.Errorf("expected a warning about the deeper paths: got %v", convErrs)
+	}
+}
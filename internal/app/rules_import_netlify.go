@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// netlifyPlaceholder matches the :name placeholders of a Netlify rule
+var netlifyPlaceholder = regexp.MustCompile(`:[a-zA-Z_]\w*`)
+
+/*
+ParseNetlify converts the `from to [status][!]` rules of a Netlify _redirects file, the status code defaults to a 301.
+A trailing splat or a :placeholder of the from path becomes a capture group, referenced as $n in the target.
+Rewrites with a 200, custom error pages and rules with query parameters or conditions can't be converted.
+*/
+func ParseNetlify(content []byte) ([]api.Redirect, []ConversionError) {
+	c := &legacyConverter{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		converted := len(c.redirects)
+		r, err := convertNetlifyRule(fields)
+		c.add(line, text, r, err)
+
+		// Netlify matches a path with and without a trailing slash, the index tells them apart by their number of segments
+		if len(c.redirects) > converted && r.FromDomain == "" && !strings.HasSuffix(r.FromURL, "/$") && !spansSegments(r.FromURL) {
+			r.FromURL = strings.TrimSuffix(r.FromURL, "$") + "/$"
+			c.add(line, text, r, nil)
+		}
+	}
+
+	return c.result()
+}
+
+func convertNetlifyRule(fields []string) (api.Redirect, error) {
+	if len(fields) < 2 {
+		return api.Redirect{}, fmt.Errorf("expected a path and a target URL")
+	}
+	// Query parameters to match come between the paths, e.g. /store id=:id /products/:id
+	if strings.Contains(fields[1], "=") && !strings.HasPrefix(fields[1], "/") && !strings.Contains(fields[1], "://") {
+		return api.Redirect{}, fmt.Errorf("query parameters can't be converted")
+	}
+	from, target, args := fields[0], fields[1], fields[2:]
+
+	statusCode := http.StatusMovedPermanently
+	if len(args) > 0 {
+		var err error
+		// A trailing exclamation mark forces the redirect even if the path exists, which is the default here
+		if statusCode, err = redirectStatus(strings.TrimSuffix(args[0], "!")); err != nil {
+			return api.Redirect{}, err
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return api.Redirect{}, fmt.Errorf("conditions can't be converted")
+	}
+
+	host := ""
+	if scheme, rest, ok := strings.Cut(from, "://"); ok && (scheme == "http" || scheme == "https") {
+		host, from, _ = strings.Cut(rest, "/")
+		from = "/" + from
+	}
+
+	pattern, captures, err := netlifyPattern(from)
+	if err != nil {
+		return api.Redirect{}, err
+	}
+	target = netlifyPlaceholder.ReplaceAllStringFunc(target, func(placeholder string) string {
+		if n, ok := captures[placeholder[1:]]; ok {
+			return "$" + strconv.Itoa(n)
+		}
+		return placeholder
+	})
+
+	if host != "" {
+		return domainRedirect(regexp.QuoteMeta(host), pattern, target, statusCode)
+	}
+
+	return pathRedirect(pattern, target, statusCode)
+}
+
+// netlifyPattern returns the pattern of a Netlify path and the capture group numbers of its placeholders
+func netlifyPattern(path string) (string, map[string]int, error) {
+	captures := make(map[string]int)
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "*":
+			if i != len(segments)-1 {
+				return "", nil, fmt.Errorf("a splat is only supported at the end of the path")
+			}
+			captures["splat"] = len(captures) + 1
+			segments[i] = "(.*)"
+		case strings.HasPrefix(segment, ":"):
+			captures[segment[1:]] = len(captures) + 1
+			segments[i] = "([^/]+)"
+		default:
+			segments[i] = regexp.QuoteMeta(segment)
+		}
+	}
+
+	return "^" + strings.Join(segments, "/") + "$", captures, nil
+}
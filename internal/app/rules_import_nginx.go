@@ -0,0 +1,369 @@
+package app
+
+import (
+	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// nginxVariable matches the variables of nginx, the numbered captures aside
+var nginxVariable = regexp.MustCompile(`\$\{?[a-zA-Z_]\w*\}?`)
+
+// nginxStatement is a directive ending with a semicolon, or opening a block
+type nginxStatement struct {
+	line  int
+	args  []string
+	block bool
+}
+
+// nginxBlock is an open block, e.g. a server or a location
+type nginxBlock struct {
+	name        string
+	args        []string
+	serverNames []string
+}
+
+// nginxMapEntry is an entry of a map block, converted once it is known how the map variable redirects
+type nginxMapEntry struct {
+	line   int
+	text   string
+	key    string
+	target string
+	mapVar string
+}
+
+/*
+ParseNginx converts the rewrite directives, the return directives of locations and servers and the maps of an nginx config.
+A return of a server redirects its server_name hosts, a location with a prefix match only redirects its exact path.
+The entries of a map of $uri or $request_uri are redirected with the status code of the return or rewrite using the map variable.
+*/
+func ParseNginx(content []byte) ([]api.Redirect, []ConversionError) {
+	c := &legacyConverter{}
+	var stack []*nginxBlock
+	var mapEntries []nginxMapEntry
+	mapStatus := make(map[string]int)
+	lines := strings.Split(string(content), "\n")
+	text := func(line int) string { return lines[line-1] }
+
+	// The maps are declared on the http level, but they can follow the servers using them
+	statements := tokenizeNginx(string(content))
+	mapVars := make(map[string]bool)
+	for _, stmt := range statements {
+		if stmt.block && len(stmt.args) == 3 && stmt.args[0] == "map" {
+			mapVars[stmt.args[2]] = true
+		}
+	}
+
+	for _, stmt := range statements {
+		if stmt.block {
+			// A closing brace is a block statement without arguments
+			if len(stmt.args) == 0 {
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+				continue
+			}
+			block := &nginxBlock{name: stmt.args[0], args: stmt.args[1:]}
+			stack = append(stack, block)
+			if block.name == "map" && (len(block.args) != 2 || (block.args[0] != "$uri" && block.args[0] != "$request_uri")) {
+				c.fail(stmt.line, text(stmt.line), fmt.Errorf("only maps of $uri or $request_uri can be converted"))
+			}
+			continue
+		}
+
+		var current *nginxBlock
+		if len(stack) > 0 {
+			current = stack[len(stack)-1]
+		}
+
+		switch {
+		case current != nil && current.name == "map":
+			if len(current.args) != 2 || (current.args[0] != "$uri" && current.args[0] != "$request_uri") {
+				continue
+			}
+			switch stmt.args[0] {
+			case "default", "hostnames", "include", "volatile":
+				continue
+			}
+			if len(stmt.args) != 2 {
+				c.fail(stmt.line, text(stmt.line), fmt.Errorf("expected a path and a target URL"))
+				continue
+			}
+			mapEntries = append(mapEntries, nginxMapEntry{
+				line: stmt.line, text: text(stmt.line), key: stmt.args[0], target: stmt.args[1], mapVar: current.args[1],
+			})
+		case stmt.args[0] == "server_name":
+			if server := enclosingBlock(stack, "server"); server != nil {
+				server.serverNames = append(server.serverNames, stmt.args[1:]...)
+			}
+		case stmt.args[0] == "rewrite":
+			// A rewrite to a map variable, e.g. rewrite ^ $new_uri permanent;
+			if len(stmt.args) > 2 && mapVars[stmt.args[2]] {
+				if statusCode, err := nginxRewriteStatus(stmt.args[2:]); err == nil {
+					mapStatus[stmt.args[2]] = statusCode
+				}
+				continue
+			}
+			r, err := convertNginxRewrite(stmt.args[1:])
+			c.add(stmt.line, text(stmt.line), r, err)
+		case stmt.args[0] == "return":
+			// A return of a map variable, e.g. return 301 $new_uri;
+			if len(stmt.args) == 3 && mapVars[stmt.args[2]] {
+				if statusCode, err := redirectStatus(stmt.args[1]); err == nil {
+					mapStatus[stmt.args[2]] = statusCode
+				}
+				continue
+			}
+			r, err := convertNginxReturn(stmt.args[1:], stack)
+			c.add(stmt.line, text(stmt.line), r, err)
+		}
+	}
+
+	for _, entry := range mapEntries {
+		r, err := convertNginxMapEntry(entry, mapStatus[entry.mapVar])
+		c.add(entry.line, entry.text, r, err)
+	}
+
+	return c.result()
+}
+
+func enclosingBlock(stack []*nginxBlock, name string) *nginxBlock {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].name == name {
+			return stack[i]
+		}
+	}
+
+	return nil
+}
+
+// nginxRewriteStatus returns the status code of the flag of a rewrite, or an error for an internal rewrite
+func nginxRewriteStatus(args []string) (int, error) {
+	absolute := strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") || strings.HasPrefix(args[0], "$scheme")
+	flag := ""
+	if len(args) > 1 {
+		flag = args[1]
+	}
+
+	switch {
+	case flag == "permanent":
+		return http.StatusMovedPermanently, nil
+	case flag == "redirect" || absolute:
+		return http.StatusFound, nil
+	}
+
+	return 0, fmt.Errorf("internal rewrite, not a redirect")
+}
+
+// convertNginxRewrite converts `rewrite regex replacement [flag]`, the regex matches the path
+func convertNginxRewrite(args []string) (api.Redirect, error) {
+	if len(args) < 2 {
+		return api.Redirect{}, fmt.Errorf("expected a pattern and a replacement")
+	}
+	statusCode, err := nginxRewriteStatus(args[1:])
+	if err != nil {
+		return api.Redirect{}, err
+	}
+
+	target, err := nginxTarget(args[0], args[1], "")
+	if err != nil {
+		return api.Redirect{}, err
+	}
+
+	return pathRedirect(args[0], target, statusCode)
+}
+
+// convertNginxReturn converts `return code url` of a location, or of a server with a server_name
+func convertNginxReturn(args []string, stack []*nginxBlock) (api.Redirect, error) {
+	statusCode := http.StatusFound
+	if len(args) != 1 || !strings.Contains(args[0], "://") {
+		var err error
+		if statusCode, err = redirectStatus(args[0]); err != nil {
+			return api.Redirect{}, err
+		}
+		if args = args[1:]; len(args) != 1 {
+			return api.Redirect{}, fmt.Errorf("expected a status code and a target URL")
+		}
+	}
+	target := args[0]
+
+	if len(stack) > 0 && stack[len(stack)-1].name == "if" {
+		return api.Redirect{}, fmt.Errorf("conditional redirects can't be converted")
+	}
+
+	if location := enclosingBlock(stack, "location"); location != nil {
+		pattern, path, err := nginxLocationPattern(location.args)
+		if err != nil {
+			return api.Redirect{}, err
+		}
+		if target, err = nginxTarget(pattern, target, path); err != nil {
+			return api.Redirect{}, err
+		}
+
+		return pathRedirect(pattern, target, statusCode)
+	}
+
+	server := enclosingBlock(stack, "server")
+	if server == nil || len(server.serverNames) == 0 {
+		return api.Redirect{}, fmt.Errorf("a return outside of a location needs a server_name to be converted")
+	}
+	if len(server.serverNames) > 1 {
+		return api.Redirect{}, fmt.Errorf("a return of a server with several names can't be converted, split it per name")
+	}
+
+	// The whole path of the request is captured for $request_uri or $uri
+	target = strings.NewReplacer("$request_uri", "$1", "$uri", "$1").Replace(target)
+	if nginxVariable.MatchString(target) {
+		return api.Redirect{}, fmt.Errorf("variables can't be converted")
+	}
+	host, err := nginxHostPattern(server.serverNames[0])
+	if err != nil {
+		return api.Redirect{}, err
+	}
+
+	return domainRedirect(host, "(/.*)$", target, statusCode)
+}
+
+// nginxHostPattern returns the pattern of a server name, which can be a regex or have a leading wildcard
+func nginxHostPattern(name string) (string, error) {
+	switch {
+	case name == "_" || name == "" || strings.HasSuffix(name, ".*"):
+		return "", fmt.Errorf("the server name %q can't be converted", name)
+	case strings.HasPrefix(name, "~"):
+		return strings.TrimPrefix(name, "~"), nil
+	case strings.HasPrefix(name, "*."):
+		return `[^/]+\.` + regexp.QuoteMeta(name[2:]), nil
+	case strings.HasPrefix(name, "."):
+		return `(?:[^/]+\.)?` + regexp.QuoteMeta(name[1:]), nil
+	}
+
+	return regexp.QuoteMeta(name), nil
+}
+
+// nginxLocationPattern returns the path pattern of a location, and the path of a location without a regex
+func nginxLocationPattern(args []string) (pattern string, path string, err error) {
+	switch {
+	case len(args) == 1 && strings.HasPrefix(args[0], "@"):
+		return "", "", fmt.Errorf("named locations can't be converted")
+	case len(args) == 1:
+		return exactPath(args[0]), args[0], nil
+	case len(args) == 2 && (args[0] == "=" || args[0] == "^~"):
+		return exactPath(args[1]), args[1], nil
+	case len(args) == 2 && (args[0] == "~" || args[0] == "~*"):
+		return args[1], "", nil
+	}
+
+	return "", "", fmt.Errorf("unsupported location")
+}
+
+/*
+nginxTarget translates the named captures of the pattern into the $n syntax and drops the trailing question mark,
+which only drops the query string. $request_uri and $uri are replaced with the path of a location without a regex.
+*/
+func nginxTarget(pattern, target, path string) (string, error) {
+	target = strings.TrimSuffix(target, "?")
+	if path != "" {
+		target = strings.NewReplacer("$request_uri", path, "$uri", path).Replace(target)
+	}
+
+	if re, err := regexp.Compile(pattern); err == nil {
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				target = strings.NewReplacer("${"+name+"}", fmt.Sprintf("$%d", i), "$"+name, fmt.Sprintf("$%d", i)).Replace(target)
+			}
+		}
+	}
+	if nginxVariable.MatchString(target) {
+		return "", fmt.Errorf("variables can't be converted")
+	}
+
+	return target, nil
+}
+
+// convertNginxMapEntry converts a map entry, the key is a path or a regex starting with a tilde
+func convertNginxMapEntry(entry nginxMapEntry, statusCode int) (api.Redirect, error) {
+	pattern := exactPath(entry.key)
+	if strings.HasPrefix(entry.key, "~") {
+		pattern = strings.TrimPrefix(strings.TrimPrefix(entry.key, "~"), "*")
+	}
+
+	target, err := nginxTarget(pattern, entry.target, "")
+	if err != nil {
+		return api.Redirect{}, err
+	}
+
+	return pathRedirect(pattern, target, statusCode)
+}
+
+// tokenizeNginx splits an nginx config into statements, skipping the comments and keeping quoted arguments together
+func tokenizeNginx(content string) []nginxStatement {
+	var statements []nginxStatement
+	var args []string
+	var arg strings.Builder
+	inArg, line, argsLine := false, 1, 1
+
+	endArg := func() {
+		if inArg {
+			args = append(args, arg.String())
+			arg.Reset()
+			inArg = false
+		}
+	}
+	endStatement := func(block bool) {
+		endArg()
+		if len(args) > 0 || block {
+			statements = append(statements, nginxStatement{line: argsLine, args: args, block: block})
+		}
+		args = nil
+	}
+
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+		switch {
+		case ch == '\n':
+			endArg()
+			line++
+		case ch == '#' && !inArg:
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			i--
+		case ch == '"' || ch == '\'':
+			quote := ch
+			if len(args) == 0 && !inArg {
+				argsLine = line
+			}
+			inArg = true
+			for i++; i < len(content) && content[i] != quote; i++ {
+				// Only the quotes and the backslash itself are escaped, a regex keeps its backslashes
+				if content[i] == '\\' && i+1 < len(content) && strings.IndexByte(`"'\\`, content[i+1]) != -1 {
+					i++
+				}
+				if content[i] == '\n' {
+					line++
+				}
+				arg.WriteByte(content[i])
+			}
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			endArg()
+		case ch == ';':
+			endStatement(false)
+		case ch == '{':
+			endStatement(true)
+		case ch == '}':
+			endStatement(false)
+			argsLine = line
+			endStatement(true)
+		default:
+			if len(args) == 0 && !inArg {
+				argsLine = line
+			}
+			arg.WriteByte(ch)
+			inArg = true
+		}
+	}
+
+	return statements
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateRedirects_RowErrors(t *testing.T) {
+	redirects := []api.Redirect{
+		{Id: "valid", FromURL: "^/school/(.*)$", ToURL: "/school/$1"},
+		{Id: "pattern", FromURL: "/school/(", ToURL: "/school"},
+		{Id: "domain", FromDomain: "old[.com", ToURL: "https://new.com"},
+		{Id: "target", FromURL: "/home"},
+		{Id: "valid", FromURL: "/home", ToURL: "/"},
+	}
+
+	rowErrors := ValidateRedirects(redirects)
+
+	expected := []string{
+		"row 2 (pattern): invalid fromURL: error parsing regexp: missing closing ): `/school/(`",
+		"row 3 (domain): invalid fromDomain: error parsing regexp: missing closing ]: `[.com`",
+		"row 4 (target): toURL is required",
+		"row 5 (valid): duplicate id of row 1",
+	}
+	if len(rowErrors) != len(expected) {
+		t.Fatalf("unexpected row errors: got %v want %v", rowErrors, expected)
+	}
+	for i, rowErr := range rowErrors {
+		if rowErr.Error() != expected[i] {
+			t.Errorf("unexpected row error: got %q want %q", rowErr.Error(), expected[i])
+		}
+	}
+}
+
+func TestImportAndExportRedirects(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	rulesFile := filepath.Join(t.TempDir(), "rules.csv")
+	content := "fromURL,fromDomain,toURL\n/school/assignments,,/school/items\n,old-domain.com$,https://new-domain.com\n"
+	if err := os.WriteFile(rulesFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+	redirects, err := ReadRulesFile(rulesFile)
+	if err != nil {
+		t.Fatalf("Failed to read rules file: %v", err)
+	}
+	if err := ImportLocalRedirects(db, redirects); err != nil {
+		t.Fatalf("Failed to import redirects: %v", err)
+	}
+
+	// The imported redirects are synced as local overrides
+	localSource := NewLocalOverrideSource(db)
+	rm := NewRedirectManager(db, []RuleSource{localSource}, time.Hour, DeletionThreshold{})
+	changes, err := localSource.FetchChanges("")
+	if err != nil {
+		t.Fatalf("Failed to fetch local changes: %v", err)
+	}
+	if err := rm.applyChanges(changes); err != nil {
+		t.Fatalf("Failed to apply local changes: %v", err)
+	}
+	if redirectURL, _ := rm.IndexedRedirects.Match("/school/assignments"); redirectURL != "/school/items" {
+		t.Errorf("unexpected redirect: got %v want /school/items", redirectURL)
+	}
+
+	stored, err := LoadStoredRedirects(db)
+	if err != nil {
+		t.Fatalf("Failed to load stored redirects: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ExportRedirects(&buf, stored, CSVFormat); err != nil {
+		t.Fatalf("Failed to export redirects: %v", err)
+	}
+
+	// The export can be read again as a rules file
+	exportFile := filepath.Join(t.TempDir(), "export.csv")
+	if err := os.WriteFile(exportFile, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write export file: %v", err)
+	}
+	exported, err := ReadRulesFile(exportFile)
+	if err != nil {
+		t.Fatalf("Failed to read export file: %v", err)
+	}
+	if len(exported) != 2 {
+		t.Fatalf("unexpected exported redirects: got %d want 2", len(exported))
+	}
+	for _, r := range exported {
+		if r.Id != ruleKey(&r) || r.UpdatedAt.IsZero() {
+			t.Errorf("unexpected exported redirect: %+v", r)
+		}
+	}
+}
+
+func TestReadImportedRules_OtherSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.csv")
+	content := `id,source,fromURL,fromDomain,toURL
+hotfix,local,^/contact$,,/help
+1,central,^/about$,,/company/about
+new,,^/jobs$,,/careers
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+
+	redirects, rowErrors, err := ReadImportedRules(path)
+	if err != nil {
+		t.Fatalf("Failed to read rules file: %v", err)
+	}
+	if len(redirects) != 3 {
+		t.Errorf("unexpected redirects: %+v", redirects)
+	}
+	// The central redirect would be pinned as a local override
+	if len(rowErrors) != 1 || rowErrors[0].Row != 2 || rowErrors[0].Id != "1" {
+		t.Errorf("unexpected row errors: %+v", rowErrors)
+	}
+}
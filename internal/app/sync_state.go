@@ -0,0 +1,66 @@
+package app
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// SyncState is the persisted position of the sync of a rule source, so a restart resumes where its last sync stopped
+type SyncState struct {
+	Source       string
+	LastSyncTime time.Time
+	Watermark    string
+	// RuleSetVersion is the version of the rule sets of all sources after the sync, the latest one is the current version
+	RuleSetVersion int
+	// RuleCount is the number of redirects of the source
+	RuleCount int
+}
+
+// LoadSyncState reads the sync state of every source by name, the sources that never synced are missing
+func LoadSyncState(db *sql.DB) (map[string]SyncState, error) {
+	states := make(map[string]SyncState)
+
+	rows, err := db.Query("SELECT source, lastSyncTime, watermark, ruleSetVersion, ruleCount FROM sync_state")
+	if err != nil {
+		return states, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("Error closing rows:", err)
+		}
+	}()
+
+	for rows.Next() {
+		var state SyncState
+		var lastSyncTime sql.NullTime
+		if err := rows.Scan(&state.Source, &lastSyncTime, &state.Watermark, &state.RuleSetVersion, &state.RuleCount); err != nil {
+			return states, err
+		}
+		state.LastSyncTime = lastSyncTime.Time
+		states[state.Source] = state
+	}
+
+	return states, rows.Err()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SaveSyncState stores the sync state of its source, leaving the state of the other sources as is
+func SaveSyncState(db execer, state SyncState) error {
+	stmt := `
+			INSERT INTO sync_state (source, lastSyncTime, watermark, ruleSetVersion, ruleCount)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(source) DO UPDATE
+			SET lastSyncTime = EXCLUDED.lastSyncTime, watermark = EXCLUDED.watermark,
+			    ruleSetVersion = EXCLUDED.ruleSetVersion, ruleCount = EXCLUDED.ruleCount;
+			`
+
+	_, err := db.Exec(stmt, state.Source, state.LastSyncTime, state.Watermark, state.RuleSetVersion, state.RuleCount)
+	return err
+}
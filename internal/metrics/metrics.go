@@ -0,0 +1,256 @@
+/*
+Package metrics keeps counters, gauges and histograms and writes them in the Prometheus text exposition format.
+The metrics are registered on the Default registry when they are created, like the package variables of the Prometheus client.
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the histograms of request latencies
+var DefaultBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics in the order they were registered
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// Default is the registry the metrics of the app are registered on
+var Default = &Registry{}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	// mu guards the series map, the values of a series are updated without it
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	// value holds the bits of the float64 value, or of the sum of a histogram
+	value atomic.Uint64
+	// counts holds the observations per histogram bucket, not cumulated
+	counts []atomic.Uint64
+	count  atomic.Uint64
+}
+
+func (s *series) add(delta float64) {
+	for {
+		old := s.value.Load()
+		if s.value.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (s *series) load() float64 {
+	return math.Float64frombits(s.value.Load())
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	m := &metric{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	// Metrics without labels are reported from the start
+	if len(labels) == 0 {
+		m.get()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.metrics {
+		if registered.name == name {
+			panic(fmt.Sprintf("metric %s is already registered", name))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+
+	return m
+}
+
+// get returns the series of the label values, the metric is only locked for writing to add a series
+func (m *metric) get(labelValues ...string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", m.name, len(m.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	m.mu.RLock()
+	s, ok := m.series[key]
+	m.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.series[key]; ok {
+		return s
+	}
+	s = &series{labelValues: labelValues, counts: make([]atomic.Uint64, len(m.buckets))}
+	m.series[key] = s
+
+	return s
+}
+
+// Counter is a value that only goes up, like a number of requests
+type Counter struct{ m *metric }
+
+// NewCounter registers a counter on the Default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{Default.register(name, help, "counter", nil, labels)}
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the series of the label values, adding zero reports the series before it is counted
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("counter %s can't decrease", c.m.name))
+	}
+
+	c.m.get(labelValues...).add(value)
+}
+
+// Gauge is a value that can go up and down, like a number of rules
+type Gauge struct{ m *metric }
+
+// NewGauge registers a gauge on the Default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{Default.register(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the series of the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.m.get(labelValues...).value.Store(math.Float64bits(value))
+}
+
+// Histogram counts observations, like latencies, in buckets of upper bounds
+type Histogram struct{ m *metric }
+
+// NewHistogram registers a histogram with the increasing upper bounds of its buckets on the Default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{Default.register(name, help, "histogram", buckets, labels)}
+}
+
+// Observe adds an observation to the series of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	s := h.m.get(labelValues...)
+	if i := sort.SearchFloat64s(h.m.buckets, value); i < len(h.m.buckets) {
+		s.counts[i].Add(1)
+	}
+	s.add(value)
+	s.count.Add(1)
+}
+
+// ObserveSince observes the seconds elapsed since the start
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Write writes the metrics of the Default registry
+func Write(w io.Writer) error {
+	return Default.Write(w)
+}
+
+// Write writes the metrics in the text exposition format, the series of every metric are ordered by their label values
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]*metric{}, r.metrics...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// write writes the series as they are, an observation in progress can be missing from some of the values of a histogram
+func (m *metric) write(b *strings.Builder) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, m.labelPairs(s.labelValues), formatValue(s.load()))
+			continue
+		}
+
+		// An observation in progress is counted in its bucket before the count, which is raised to keep +Inf the largest bucket
+		count := s.count.Load()
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += s.counts[i].Load()
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelPairs(s.labelValues, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelPairs(s.labelValues, "le", "+Inf"), max(count, cumulative))
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, m.labelPairs(s.labelValues), formatValue(s.load()))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, m.labelPairs(s.labelValues), max(count, cumulative))
+	}
+}
+
+// labelPairs formats the labels of a series, followed by an extra label like the bucket of a histogram
+func (m *metric) labelPairs(labelValues []string, extra ...string) string {
+	var pairs []string
+	for i, label := range m.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+extra[1]+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
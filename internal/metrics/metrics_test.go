@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	registry := Default
+	Default = &Registry{}
+	t.Cleanup(func() { Default = registry })
+
+	requests := NewCounter("test_requests_total", "Requests by result.", "result")
+	NewCounter("test_errors_total", "Errors.")
+	rules := NewGauge("test_rules", "Rules by bucket.", "bucket")
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+
+	requests.Inc("path")
+	requests.Add(2, `do"main`)
+	rules.Set(5, "path")
+	rules.Set(3, "path")
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	var b strings.Builder
+	if err := Write(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `# HELP test_requests_total Requests by result.
+# TYPE test_requests_total counter
+test_requests_total{result="do\"main"} 2
+test_requests_total{result="path"} 1
+# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_rules Rules by bucket.
+# TYPE test_rules gauge
+test_rules{bucket="path"} 3
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 2.55
+test_latency_seconds_count 3
+`
+	if b.String() != expected {
+		t.Errorf("unexpected metrics:\n%s\nwant:\n%s", b.String(), expected)
+	}
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	registry := Default
+	Default = &Registry{}
+	t.Cleanup(func() { Default = registry })
+
+	requests := NewCounter("test_requests_total", "Requests by result.", "result")
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				requests.Inc("path")
+				latency.Observe(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	if err := Write(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range []string{`test_requests_total{result="path"} 8000`, `test_latency_seconds_count 8000`, `test_latency_seconds_sum 4000`} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, b.String())
+		}
+	}
+}
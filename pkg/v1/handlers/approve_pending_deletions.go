@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+func ApprovePendingDeletions(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deleted, err := redirectManager.ApprovePendingDeletions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		_, err = fmt.Fprintf(w, "Deleted %d redirects\n", deleted)
+		if err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
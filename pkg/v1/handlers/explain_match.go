@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ExplainMatch traces how the URL in the request body is matched: the buckets looked in, the rules tried and the rule that won
+func ExplainMatch(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			return
+		}
+
+		trace, err := redirectManager.IndexedRedirects.Explain(strings.TrimSpace(string(requestBody)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(trace); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+// GetConflicts returns the conflicts between the indexed rules found after the latest sync, optionally of a single kind
+func GetConflicts(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := redirectManager.Conflicts()
+		if kind := r.URL.Query().Get("kind"); kind != "" {
+			conflicts := make([]app.Conflict, 0)
+			for _, conflict := range report.Conflicts {
+				if conflict.Kind == kind {
+					conflicts = append(conflicts, conflict)
+				}
+			}
+			report.Conflicts = conflicts
+		}
+		if report.Conflicts == nil {
+			report.Conflicts = []app.Conflict{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+	"time"
+)
+
+// GetHealth tells the app is up, whether it can serve redirects is up to GetReadiness
+func GetHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write([]byte(`{"status":"ok"}` + "\n")); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
+
+// GetReadiness reports the readiness checks, with a 503 status while any of them fails
+func GetReadiness(redirectManager *app.RedirectManager, graphqlClient *api.GraphQLClient, maxStaleness time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := redirectManager.Readiness(graphqlClient, maxStaleness)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(readiness); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
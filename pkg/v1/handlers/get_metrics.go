@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/metrics"
+	"log"
+	"net/http"
+)
+
+// GetMetrics writes the metrics of the app in the Prometheus text format
+func GetMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.ContentType)
+		if err := metrics.Write(w); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
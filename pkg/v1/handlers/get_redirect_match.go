@@ -3,13 +3,24 @@ package handlers
 import (
 	"fmt"
 	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/metrics"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// RedirectStatusHeader tells the plugin the status code to redirect a matched request with
+const RedirectStatusHeader = "X-Redirect-Status"
+
+var matchDuration = metrics.NewHistogram("redirects_match_duration_seconds",
+	"Duration of answering the match requests of the plugin, including logging the request.", metrics.DefaultBuckets)
+
 func GetRedirectMatch(logger *app.Logger, redirectManager *app.RedirectManager) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		defer matchDuration.ObserveSince(time.Now())
+
 		requestBody, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
@@ -23,9 +34,11 @@ func GetRedirectMatch(logger *app.Logger, redirectManager *app.RedirectManager)
 		}
 
 		// Matching against the defined redirects
-		redirectURL, ok := redirectManager.IndexedRedirects.Match(request)
+		redirectURL, statusCode, ok := redirectManager.IndexedRedirects.MatchRedirect(request)
 		if !ok {
 			redirectURL = "@empty"
+		} else {
+			w.Header().Set(RedirectStatusHeader, strconv.Itoa(statusCode))
 		}
 
 		// Write the redirect URL to the response
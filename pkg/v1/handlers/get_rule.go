@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+	"strings"
+)
+
+/*
+GetRule returns a redirect by its id and the source parameter. The source can be left out when a single source has the id,
+as the ids are only unique within a source.
+*/
+func GetRule(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules := redirectManager.Rule(r.PathValue("id"), r.URL.Query().Get("source"))
+		if len(rules) == 0 {
+			http.Error(w, "Rule not found", http.StatusNotFound)
+			return
+		}
+		if len(rules) > 1 {
+			sources := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				sources = append(sources, rule.Source)
+			}
+			http.Error(w, "Rule id of several sources, pass one of them as the source parameter: "+strings.Join(sources, ", "), http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rules[0]); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
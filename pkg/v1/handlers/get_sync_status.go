@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+func GetSyncStatus(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(redirectManager.Status())
+		if err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
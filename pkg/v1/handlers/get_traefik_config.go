@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+// GetTraefikConfig renders the indexed redirects as a Traefik dynamic configuration, the path rules are routed for the host parameters
+func GetTraefikConfig(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config, warnings := app.TraefikDynamicConfig(redirectManager.IndexedRules(), r.URL.Query()["host"])
+
+		w.Header().Set("Content-Type", "application/yaml")
+		if err := app.WriteTraefikConfig(w, config, warnings); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
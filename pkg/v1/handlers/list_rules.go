@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// The page size of the rules listing, unless a limit is given
+const (
+	defaultRulesLimit = 50
+	maxRulesLimit     = 500
+)
+
+// RulesPage is a page of the redirects passing the search, total counts all of them
+type RulesPage struct {
+	Rules  []app.RuleInfo `json:"rules"`
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+}
+
+/*
+ListRules lists the redirects of all sources, with their state, quarantine reason and hit count.
+The redirects are searched with the fromURL, toURL, domain, source and state parameters, and paged with offset and limit.
+*/
+func ListRules(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		offset, err := queryInt(query.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		limit, err := queryInt(query.Get("limit"), defaultRulesLimit)
+		if err != nil || limit < 1 || limit > maxRulesLimit {
+			http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(maxRulesLimit), http.StatusBadRequest)
+			return
+		}
+
+		rules := redirectManager.Rules(app.RuleFilter{
+			Source:     query.Get("source"),
+			State:      query.Get("state"),
+			FromURL:    query.Get("fromURL"),
+			FromDomain: query.Get("domain"),
+			ToURL:      query.Get("toURL"),
+		})
+		page := RulesPage{Rules: rules[min(offset, len(rules)):min(offset+limit, len(rules))], Total: len(rules), Offset: offset, Limit: limit}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
+
+func queryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
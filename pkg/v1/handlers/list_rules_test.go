@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestAdminAPI serves the admin API of a central source with the stored redirects 1 to n, and local overrides with the ids
+func newTestAdminAPI(t *testing.T, n int, localIds ...string) *http.ServeMux {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "redirects.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := app.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	for i := 1; i <= n; i++ {
+		_, err := db.Exec(`INSERT INTO redirects (source, id, fromURL, fromDomain, toURL, updatedAt) VALUES ('central', ?, ?, '', ?, ?)`,
+			fmt.Sprintf("%02d", i), fmt.Sprintf("^/old-%d$", i), fmt.Sprintf("/new-%d", i), time.Now())
+		if err != nil {
+			t.Fatalf("Failed to insert redirect: %v", err)
+		}
+	}
+	for _, id := range localIds {
+		_, err := db.Exec(`INSERT INTO redirects (source, id, fromURL, fromDomain, toURL, updatedAt) VALUES ('local', ?, ?, '', ?, ?)`,
+			id, "^/local-"+id+"$", "/new-local-"+id, time.Now())
+		if err != nil {
+			t.Fatalf("Failed to insert redirect: %v", err)
+		}
+	}
+
+	sources := []app.RuleSource{app.NewLocalOverrideSource(db), app.NewCentralSource(nil)}
+	redirectManager := app.NewRedirectManager(db, sources, time.Hour, app.DeletionThreshold{})
+	redirectManager.PopulateMapsWithDataFromDB()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rules", ListRules(redirectManager))
+	mux.HandleFunc("GET /rules/{id...}", GetRule(redirectManager))
+	mux.HandleFunc("POST /verify", VerifyRedirects(redirectManager))
+
+	return mux
+}
+
+func TestListRules(t *testing.T) {
+	mux := newTestAdminAPI(t, 12)
+
+	testCases := []struct {
+		query          string
+		expectedStatus int
+		expectedIds    []string
+		expectedTotal  int
+	}{
+		{query: "?limit=2&offset=10", expectedStatus: http.StatusOK, expectedIds: []string{"11", "12"}, expectedTotal: 12},
+		{query: "?offset=20", expectedStatus: http.StatusOK, expectedIds: []string{}, expectedTotal: 12},
+		{query: "?fromURL=old-1", expectedStatus: http.StatusOK, expectedIds: []string{"01", "10", "11", "12"}, expectedTotal: 4},
+		{query: "?toURL=new-2&state=indexed", expectedStatus: http.StatusOK, expectedIds: []string{"02"}, expectedTotal: 1},
+		{query: "?limit=0", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rules"+tc.query, nil))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var page RulesPage
+			if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			ids := make([]string, 0, len(page.Rules))
+			for _, rule := range page.Rules {
+				ids = append(ids, rule.Id)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.expectedIds) || page.Total != tc.expectedTotal {
+				t.Errorf("unexpected page: got %v of %d want %v of %d", ids, page.Total, tc.expectedIds, tc.expectedTotal)
+			}
+		})
+	}
+}
+
+func TestGetRule(t *testing.T) {
+	mux := newTestAdminAPI(t, 1)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rules/01", nil))
+	var rule app.RuleInfo
+	if err := json.NewDecoder(rr.Body).Decode(&rule); err != nil || rule.ToURL != "/new-1" || rule.State != app.RuleIndexed {
+		t.Errorf("unexpected rule: %+v, %v", rule, err)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rules/01?source=local", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetRule_IdOfSeveralSources(t *testing.T) {
+	mux := newTestAdminAPI(t, 1, "01")
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rules/01", nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rules/01?source=local", nil))
+	var rule app.RuleInfo
+	if err := json.NewDecoder(rr.Body).Decode(&rule); err != nil || rule.Source != app.LocalSourceName || rule.ToURL != "/new-local-01" {
+		t.Errorf("unexpected rule: %+v, %v", rule, err)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+// maxCachedHitsBody limits the size of a batch of cached hits sent by the plugin
+const maxCachedHitsBody = 1 << 20
+
+// ReceiveCachedHits logs a batch of the requests the plugin answered from its cache
+func ReceiveCachedHits(logger *app.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var hits []app.CachedHit
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCachedHitsBody)).Decode(&hits); err != nil {
+			http.Error(w, "Invalid cached hits", http.StatusBadRequest)
+			return
+		}
+
+		if err := logger.LogCachedHits(hits); err != nil {
+			log.Println("Failed to log cached hits:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+// maxMissingPagesBody limits the size of a batch of missing pages sent by the plugin
+const maxMissingPagesBody = 1 << 20
+
+// ReceiveMissingPages records a batch of the URLs the plugin saw the upstream answer with an error status
+func ReceiveMissingPages(missingPages *app.MissingPages) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var pages []app.MissingPage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMissingPagesBody)).Decode(&pages); err != nil {
+			http.Error(w, "Invalid missing pages", http.StatusBadRequest)
+			return
+		}
+
+		if err := missingPages.Record(pages); err != nil {
+			log.Println("Failed to record missing pages:", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader       = "X-Signature-256"
+	TimestampHeader       = "X-Signature-Timestamp"
+	signaturePrefix       = "sha256="
+	redirectsChangedEvent = "redirects.changed"
+	// maxWebhookBody limits the size of a change notification
+	maxWebhookBody = 1 << 20
+	// webhookTolerance is how far the signed timestamp may be off, older notifications are rejected
+	webhookTolerance = 5 * time.Minute
+)
+
+type WebhookEvent struct {
+	Event  string `json:"event"`
+	HostId string `json:"hostId"`
+}
+
+/*
+ReceiveWebhook accepts change notifications from the Central API.
+The timestamp in the X-Signature-Timestamp header and the request body have to be signed with the shared secret
+as an HMAC-SHA256 in the X-Signature-256 header, notifications signed more than webhookTolerance ago are rejected.
+The signatures are remembered as long as their timestamp is accepted, so a notification is only accepted once.
+A "redirects.changed" event for our host triggers an immediate sync.
+*/
+func ReceiveWebhook(secret string, hostId string, redirectManager *app.RedirectManager) http.HandlerFunc {
+	seen := &seenSignatures{expiries: make(map[string]time.Time)}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestBody, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		timestamp := r.Header.Get(TimestampHeader)
+		if !VerifySignature(secret, timestamp, requestBody, r.Header.Get(SignatureHeader)) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if !isRecent(timestamp, time.Now()) {
+			http.Error(w, "Expired signature", http.StatusUnauthorized)
+			return
+		}
+		if !seen.add(r.Header.Get(SignatureHeader), time.Now()) {
+			http.Error(w, "Replayed signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event WebhookEvent
+		if err := json.Unmarshal(requestBody, &event); err != nil {
+			http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+			return
+		}
+
+		message := "Event ignored"
+		if event.Event == redirectsChangedEvent && event.HostId == hostId {
+			redirectManager.TriggerSync()
+			message = "Sync triggered"
+			log.Println("Webhook received, syncing redirects for host:", hostId)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		_, err = fmt.Fprintln(w, message)
+		if err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
+
+// SignPayload returns the signature header value for the timestamp and the payload
+func SignPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature header value against the timestamp and the payload in constant time
+func VerifySignature(secret string, timestamp string, payload []byte, signature string) bool {
+	if secret == "" || timestamp == "" || !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(SignPayload(secret, timestamp, payload)))
+}
+
+// seenSignatures holds the signatures of the accepted notifications until their timestamp expires
+type seenSignatures struct {
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+// add remembers a signature, it returns false when the signature was seen before
+func (s *seenSignatures) add(signature string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for seen, expiry := range s.expiries {
+		if now.After(expiry) {
+			delete(s.expiries, seen)
+		}
+	}
+	if _, ok := s.expiries[signature]; ok {
+		return false
+	}
+	// The timestamp may be up to webhookTolerance ahead, so it is accepted for at most twice that long
+	s.expiries[signature] = now.Add(2 * webhookTolerance)
+
+	return true
+}
+
+// isRecent tells whether the unix timestamp in seconds is within the webhookTolerance of now
+func isRecent(timestamp string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	return age <= webhookTolerance && age >= -webhookTolerance
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// startWebhookReceiver serves the webhook receiver, which the tests post signed notifications to
+func startWebhookReceiver(redirectManager *app.RedirectManager) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhook", ReceiveWebhook(testWebhookSecret, "host-1", redirectManager))
+
+	return httptest.NewServer(mux)
+}
+
+func postWebhook(t *testing.T, url, body, timestamp, signature string) int {
+	req, err := http.NewRequest(http.MethodPost, url+"/webhook", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, signature)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post webhook: %v", err)
+	}
+	_ = res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		secret         string
+		signedAt       time.Time
+		expectedStatus int
+		expectedSync   bool
+	}{
+		{
+			name:           "Signed change notification for our host",
+			body:           `{"event":"redirects.changed","hostId":"host-1"}`,
+			secret:         testWebhookSecret,
+			signedAt:       time.Now(),
+			expectedStatus: http.StatusAccepted,
+			expectedSync:   true,
+		},
+		{
+			name:           "Signed change notification for another host",
+			body:           `{"event":"redirects.changed","hostId":"host-2"}`,
+			secret:         testWebhookSecret,
+			signedAt:       time.Now(),
+			expectedStatus: http.StatusAccepted,
+			expectedSync:   false,
+		},
+		{
+			name:           "Notification signed with the wrong secret",
+			body:           `{"event":"redirects.changed","hostId":"host-1"}`,
+			secret:         "wrong-secret",
+			signedAt:       time.Now(),
+			expectedStatus: http.StatusUnauthorized,
+			expectedSync:   false,
+		},
+		{
+			name:           "Notification signed too long ago",
+			body:           `{"event":"redirects.changed","hostId":"host-1"}`,
+			secret:         testWebhookSecret,
+			signedAt:       time.Now().Add(-time.Hour),
+			expectedStatus: http.StatusUnauthorized,
+			expectedSync:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redirectManager := app.NewRedirectManager(nil, nil, time.Hour, app.DeletionThreshold{})
+			server := startWebhookReceiver(redirectManager)
+			defer server.Close()
+
+			timestamp := strconv.FormatInt(tc.signedAt.Unix(), 10)
+			status := postWebhook(t, server.URL, tc.body, timestamp, SignPayload(tc.secret, timestamp, []byte(tc.body)))
+			if status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
+			}
+
+			// TriggerSync fails when the webhook already queued a sync
+			if synced := !redirectManager.TriggerSync(); synced != tc.expectedSync {
+				t.Errorf("unexpected sync trigger: got %v want %v", synced, tc.expectedSync)
+			}
+		})
+	}
+}
+
+func TestReceiveWebhook_RejectsReplays(t *testing.T) {
+	redirectManager := app.NewRedirectManager(nil, nil, time.Hour, app.DeletionThreshold{})
+	server := startWebhookReceiver(redirectManager)
+	defer server.Close()
+
+	body := `{"event":"redirects.changed","hostId":"host-1"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := SignPayload(testWebhookSecret, timestamp, []byte(body))
+	if status := postWebhook(t, server.URL, body, timestamp, signature); status != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+	if status := postWebhook(t, server.URL, body, timestamp, signature); status != http.StatusUnauthorized {
+		t.Errorf("replay returned wrong status code: got %v want %v", status, http.StatusUnauthorized)
+	}
+
+	// A new notification with the same body is signed with another timestamp
+	timestamp = strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10)
+	if status := postWebhook(t, server.URL, body, timestamp, SignPayload(testWebhookSecret, timestamp, []byte(body))); status != http.StatusAccepted {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"net/http"
+)
+
+func TriggerSync(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		message := "Sync triggered"
+		if !redirectManager.TriggerSync() {
+			message = "Sync already pending"
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		_, err := fmt.Fprintln(w, message)
+		if err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
+	"log"
+	"mime"
+	"net/http"
+)
+
+// maxVerifyBody limits the size of an uploaded list of URLs
+const maxVerifyBody = 10 << 20
+
+/*
+VerifyRedirects follows the redirects of the uploaded URLs and reports whether they end up at the expected destinations.
+The URLs are read as CSV with a text/csv content type and as JSON otherwise, the report is written as JSON unless format=csv.
+*/
+func VerifyRedirects(redirectManager *app.RedirectManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inputFormat := app.JSONFormat
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			inputFormat = app.CSVFormat
+		}
+		outputFormat := app.JSONFormat
+		if r.URL.Query().Get("format") == app.CSVFormat {
+			outputFormat = app.CSVFormat
+		}
+
+		cases, err := app.ReadVerifyCases(http.MaxBytesReader(w, r.Body, maxVerifyBody), inputFormat)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report := redirectManager.IndexedRedirects.Verify(cases)
+
+		contentType := "application/json"
+		if outputFormat == app.CSVFormat {
+			contentType = "text/csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		if err := app.WriteVerifyReport(w, report, outputFormat); err != nil {
+			log.Println("Failed to write response:", err)
+		}
+	}
+}
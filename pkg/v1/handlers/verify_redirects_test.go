@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRedirects(t *testing.T) {
+	mux := newTestAdminAPI(t, 2)
+
+	req := httptest.NewRequest(http.MethodPost, "/verify?format=csv", strings.NewReader("url,expected\n/old-1,/new-1\n/old-2,/new-3\n"))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	expected := "url,expected,status,actual,chainLength,chain\n" +
+		"/old-1,/new-1,pass,/new-1,1,/new-1\n" +
+		"/old-2,/new-3,mismatch,/new-2,1,/new-2\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("unexpected report: %d\n%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(`[{"expected":"/new-1"}]`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
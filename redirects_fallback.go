@@ -0,0 +1,123 @@
+package redirects_traefik_middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+/*
+fallbackWriter holds back the status and headers of the upstream response until its status is known.
+A 404 is replaced by a redirect when there is one, its body is discarded then. Other responses are passed on as they are.
+*/
+type fallbackWriter struct {
+	http.ResponseWriter
+	header http.Header
+	// redirect redirects the request on the underlying writer when there is a redirect for it
+	redirect    func(rw http.ResponseWriter) bool
+	wroteHeader bool
+	redirected  bool
+	hijacked    bool
+}
+
+func newFallbackWriter(rw http.ResponseWriter, redirect func(rw http.ResponseWriter) bool) *fallbackWriter {
+	return &fallbackWriter{
+		ResponseWriter: rw,
+		header:         rw.Header().Clone(),
+		redirect:       redirect,
+	}
+}
+
+func (fw *fallbackWriter) Header() http.Header {
+	return fw.header
+}
+
+func (fw *fallbackWriter) WriteHeader(statusCode int) {
+	if fw.wroteHeader {
+		return
+	}
+
+	// Informational responses like 103 Early Hints come before the final status
+	if statusCode >= 100 && statusCode <= 199 {
+		fw.copyHeader()
+		fw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	fw.wroteHeader = true
+	if statusCode == http.StatusNotFound && fw.redirect(fw.ResponseWriter) {
+		fw.redirected = true
+		return
+	}
+
+	fw.copyHeader()
+	fw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (fw *fallbackWriter) Write(b []byte) (int, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.redirected {
+		return len(b), nil
+	}
+
+	return fw.ResponseWriter.Write(b)
+}
+
+// copyHeader replaces the headers of the underlying writer with the ones the upstream set
+func (fw *fallbackWriter) copyHeader() {
+	dst := fw.ResponseWriter.Header()
+	for key := range dst {
+		if _, ok := fw.header[key]; !ok {
+			delete(dst, key)
+		}
+	}
+	for key, values := range fw.header {
+		dst[key] = values
+	}
+}
+
+// ReadFrom keeps the sendfile of the underlying writer for the files served upstream, a redirected body is discarded
+func (fw *fallbackWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.redirected {
+		return io.Copy(io.Discard, src)
+	}
+
+	return io.Copy(fw.ResponseWriter, src)
+}
+
+// finish writes the held headers of an upstream response without a body, e.g. an empty 200 or the answer to a HEAD request
+func (fw *fallbackWriter) finish() {
+	if !fw.wroteHeader && !fw.hijacked {
+		fw.WriteHeader(http.StatusOK)
+	}
+}
+
+func (fw *fallbackWriter) Flush() {
+	if !fw.wroteHeader {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := fw.ResponseWriter.(http.Flusher); ok && !fw.redirected {
+		flusher.Flush()
+	}
+}
+
+func (fw *fallbackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := fw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer doesn't support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		fw.hijacked = true
+	}
+
+	return conn, rw, err
+}
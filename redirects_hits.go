@@ -0,0 +1,113 @@
+package redirects_traefik_middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedHitsPath is the endpoint of the redirects app receiving the cache hits
+const cachedHitsPath = "/cache-hits"
+
+// cachedHit counts the requests for a cache key within a batch
+type cachedHit struct {
+	URL     string    `json:"url"`
+	Count   int64     `json:"count"`
+	LastHit time.Time `json:"lastHit"`
+}
+
+/*
+hitsReporter counts the requests answered from the cache, which never reach the redirects app,
+and sends the counts to it every interval so its request logs include them.
+*/
+type hitsReporter struct {
+	endpoint string
+	interval time.Duration
+	client   *http.Client
+	mutex    sync.Mutex
+	hits     map[string]*cachedHit
+}
+
+func newHitsReporter(ctx context.Context, redirectsAppURL string, interval time.Duration) *hitsReporter {
+	reporter := &hitsReporter{
+		endpoint: strings.TrimRight(redirectsAppURL, "/") + cachedHitsPath,
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		hits:     make(map[string]*cachedHit),
+	}
+	go reporter.run(ctx)
+
+	return reporter
+}
+
+// count counts a request for the cache key
+func (r *hitsReporter) count(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	hit, ok := r.hits[key]
+	if !ok {
+		hit = &cachedHit{URL: key}
+		r.hits[key] = hit
+	}
+	hit.Count++
+	hit.LastHit = time.Now().UTC()
+}
+
+func (r *hitsReporter) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush()
+			return
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+// flush sends the counted hits and starts counting from zero, the hits of a failed batch are dropped
+func (r *hitsReporter) flush() {
+	r.mutex.Lock()
+	hits := make([]*cachedHit, 0, len(r.hits))
+	for _, hit := range r.hits {
+		hits = append(hits, hit)
+	}
+	r.hits = make(map[string]*cachedHit)
+	r.mutex.Unlock()
+
+	if len(hits) == 0 {
+		return
+	}
+	if err := r.send(hits); err != nil {
+		log.Println("Failed to report cache hits:", err)
+	}
+}
+
+func (r *hitsReporter) send(hits []*cachedHit) error {
+	body, err := json.Marshal(hits)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.client.Post(r.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	return nil
+}
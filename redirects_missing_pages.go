@@ -0,0 +1,200 @@
+package redirects_traefik_middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// missingPagesPath is the endpoint of the redirects app receiving the missing pages
+const missingPagesPath = "/missing-pages"
+
+const (
+	defaultReportInterval = 10 * time.Second
+	// reportBatchSize sends a batch before the interval is over, once it has this many distinct pages
+	reportBatchSize = 100
+	// reportQueueSize bounds the pages waiting to be batched, pages are dropped rather than slowing down the requests
+	reportQueueSize = 1000
+)
+
+// missingPage is a URL the upstream answered with an error status, counted per referrer within a batch
+type missingPage struct {
+	URL        string    `json:"url"`
+	StatusCode int       `json:"statusCode"`
+	Referrer   string    `json:"referrer,omitempty"`
+	Count      int64     `json:"count"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// missingPagesReporter sends the missing pages to the redirects app in batches, apart from the requests
+type missingPagesReporter struct {
+	endpoint string
+	interval time.Duration
+	queue    chan missingPage
+	client   *http.Client
+}
+
+func newMissingPagesReporter(ctx context.Context, redirectsAppURL string, interval time.Duration) *missingPagesReporter {
+	reporter := &missingPagesReporter{
+		endpoint: strings.TrimRight(redirectsAppURL, "/") + missingPagesPath,
+		interval: interval,
+		queue:    make(chan missingPage, reportQueueSize),
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+	go reporter.run(ctx)
+
+	return reporter
+}
+
+// report queues a missing page without blocking, it is dropped when the queue is full
+func (r *missingPagesReporter) report(page missingPage) {
+	select {
+	case r.queue <- page:
+	default:
+	}
+}
+
+func (r *missingPagesReporter) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	batch := make(map[string]*missingPage)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.send(batch); err != nil {
+			log.Println("Failed to report missing pages:", err)
+		}
+		batch = make(map[string]*missingPage)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		case page := <-r.queue:
+			key := fmt.Sprintf("%d %s %s", page.StatusCode, page.URL, page.Referrer)
+			if batched, ok := batch[key]; ok {
+				batched.Count++
+				batched.LastSeen = page.LastSeen
+				continue
+			}
+			page.Count = 1
+			batch[key] = &page
+			if len(batch) >= reportBatchSize {
+				flush()
+			}
+		}
+	}
+}
+
+func (r *missingPagesReporter) send(batch map[string]*missingPage) error {
+	pages := make([]*missingPage, 0, len(batch))
+	for _, page := range batch {
+		pages = append(pages, page)
+	}
+
+	body, err := json.Marshal(pages)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.client.Post(r.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// statusRecorder remembers the status code the next handler answers with
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	// Informational responses come before the final status
+	if sr.statusCode == 0 && statusCode >= 200 {
+		sr.statusCode = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.statusCode == 0 {
+		sr.statusCode = http.StatusOK
+	}
+
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush and Hijack keep streaming responses and websockets working through the recorder
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer doesn't support hijacking")
+	}
+
+	return hijacker.Hijack()
+}
+
+// reportsStatus tells whether a response of the upstream with the status code is a missing page
+func (rp *RedirectsPlugin) reportsStatus(statusCode int) bool {
+	switch {
+	case statusCode == http.StatusNotFound:
+		return true
+	case statusCode == http.StatusGone:
+		return rp.reportGone
+	case statusCode >= 500 && statusCode <= 599:
+		return rp.reportServerErrors
+	default:
+		return false
+	}
+}
+
+// reportMissingPage reports the URL of the request when the upstream answered it with a missing page
+func (rp *RedirectsPlugin) reportMissingPage(req *http.Request, statusCode int) {
+	if !rp.reportsStatus(statusCode) {
+		return
+	}
+
+	var proto = "https://"
+	if req.TLS == nil {
+		proto = "http://"
+	}
+
+	var host = req.URL.Host
+	if len(host) == 0 {
+		host = req.Host
+	}
+
+	rp.missingPages.report(missingPage{
+		URL:        proto + host + req.URL.Path,
+		StatusCode: statusCode,
+		Referrer:   req.Referer(),
+		LastSeen:   time.Now().UTC(),
+	})
+}
@@ -6,14 +6,35 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const noMatchMarker = "@no_match"
 
+// redirectStatusHeader carries the status code of the matched redirect, the requests are redirected with a 302 without it
+const redirectStatusHeader = "X-Redirect-Status"
+
+// matchedRedirect is the cached redirect of a URL, its url is the noMatchMarker when there is none
+type matchedRedirect struct {
+	url        string
+	statusCode int
+}
+
 type Config struct {
 	RedirectsAppURL string `json:"redirectsAppURL,omitempty"`
+	// ReportMissingPages reports the URLs the upstream answers with a 404 to the redirects app, as candidates for new redirects
+	ReportMissingPages bool `json:"reportMissingPages,omitempty"`
+	// ReportGone and ReportServerErrors report the 410 and the 5xx responses as well
+	ReportGone         bool `json:"reportGone,omitempty"`
+	ReportServerErrors bool `json:"reportServerErrors,omitempty"`
+	// ReportHits counts the requests answered from the cache and reports them to the redirects app, to include them in its request logs
+	ReportHits bool `json:"reportHits,omitempty"`
+	// ReportInterval is the longest time missing pages and cache hits are batched before they are sent, e.g. "10s"
+	ReportInterval string `json:"reportInterval,omitempty"`
+	// FallbackMode only redirects the requests the upstream answers with a 404, instead of looking up every request first
+	FallbackMode bool `json:"fallbackMode,omitempty"`
 }
 
 func CreateConfig() *Config {
@@ -21,10 +42,15 @@ func CreateConfig() *Config {
 }
 
 type RedirectsPlugin struct {
-	next            http.Handler
-	name            string
-	redirectsAppURL string
-	cache           *Cache
+	next               http.Handler
+	name               string
+	redirectsAppURL    string
+	cache              *Cache
+	missingPages       *missingPagesReporter
+	hits               *hitsReporter
+	reportGone         bool
+	reportServerErrors bool
+	fallbackMode       bool
 }
 
 func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
@@ -38,84 +64,156 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 
 	log.Println("Redirects App Url [" + strings.ToLower(config.RedirectsAppURL) + "]")
 
-	return &RedirectsPlugin{
-		next:            next,
-		name:            name,
-		redirectsAppURL: config.RedirectsAppURL,
-		cache:           NewCache(ttl, ttl),
-	}, nil
+	rp := &RedirectsPlugin{
+		next:               next,
+		name:               name,
+		redirectsAppURL:    config.RedirectsAppURL,
+		cache:              NewCache(ttl, ttl),
+		reportGone:         config.ReportGone,
+		reportServerErrors: config.ReportServerErrors,
+		fallbackMode:       config.FallbackMode,
+	}
+
+	interval := defaultReportInterval
+	if config.ReportInterval != "" {
+		parsed, err := time.ParseDuration(config.ReportInterval)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("RedirectsPlugin 'reportInterval' is invalid: %q", config.ReportInterval)
+		}
+		interval = parsed
+	}
+	if config.ReportMissingPages {
+		rp.missingPages = newMissingPagesReporter(ctx, config.RedirectsAppURL, interval)
+	}
+	if config.ReportHits {
+		rp.hits = newHitsReporter(ctx, config.RedirectsAppURL, interval)
+	}
+
+	return rp, nil
 }
 
 /*
 ServeHTTP intercepts a request and matches it against the existing rules
 If a match is found, it redirects accordingly
+In the fallback mode the request is passed on first, and only redirected when the upstream answers with a 404
 */
 func (rp *RedirectsPlugin) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if rp.fallbackMode {
+		rp.serveNext(rw, req, true)
+		return
+	}
+
+	if rp.redirect(rw, req) {
+		return
+	}
+	rp.serveNext(rw, req, false)
+}
+
+// redirect looks up the redirect of the request, and redirects when there is one
+func (rp *RedirectsPlugin) redirect(rw http.ResponseWriter, req *http.Request) bool {
 	fullURL := getFullURL(req)
 	relativeURL := req.URL.Path
 
-	responseURL, found := rp.getCachedRedirect(fullURL)
+	match, found := rp.getCachedRedirect(fullURL)
 	if !found {
-		responseURL, found = rp.getCachedRedirect(relativeURL)
+		match, found = rp.getCachedRedirect(relativeURL)
 		// Cache the redirect for full URL if found for relative URL
-		if found && responseURL != noMatchMarker {
-			rp.cache.Set(fullURL, responseURL, rp.cache.defaultTTL)
+		if found && match.url != noMatchMarker {
+			rp.cache.Set(fullURL, match, rp.cache.defaultTTL)
 		}
 	}
 
 	// Handle the found redirect or pass to the next handler
-	if found && responseURL != noMatchMarker {
+	if found && match.url != noMatchMarker {
+		responseURL := match.url
 		log.Printf("Redirect exists: %s --> %s\n", fullURL, responseURL)
 		if !strings.HasPrefix(responseURL, "http") {
 			responseURL = getRelativeRedirect(req, responseURL)
 		}
-		http.Redirect(rw, req, responseURL, http.StatusFound)
-		return
+		http.Redirect(rw, req, responseURL, match.statusCode)
+		return true
 	}
 
 	log.Printf("Redirect does not exist: %s\n", fullURL)
+	return false
+}
+
+// serveNext passes the request to the next handler, redirecting its 404 responses in the fallback mode
+func (rp *RedirectsPlugin) serveNext(rw http.ResponseWriter, req *http.Request, fallback bool) {
+	var recorder *statusRecorder
+	if rp.missingPages != nil {
+		recorder = &statusRecorder{ResponseWriter: rw}
+		rw = recorder
+	}
+	var fw *fallbackWriter
+	if fallback {
+		fw = newFallbackWriter(rw, func(rw http.ResponseWriter) bool { return rp.redirect(rw, req) })
+		rw = fw
+	}
+
 	rp.next.ServeHTTP(rw, req)
+	if fw != nil {
+		fw.finish()
+	}
+
+	if recorder != nil {
+		rp.reportMissingPage(req, recorder.statusCode)
+	}
 }
 
-func (rp *RedirectsPlugin) getCachedRedirect(url string) (string, bool) {
+func (rp *RedirectsPlugin) getCachedRedirect(url string) (matchedRedirect, bool) {
 	value, found := rp.cache.Get(url)
 	if found {
-		return value.(string), true
+		// The redirects app only logs the requests it is asked about
+		if rp.hits != nil {
+			rp.hits.count(url)
+		}
+		return value.(matchedRedirect), true
 	}
 
 	// Fetch from the redirect service if not found in cache
-	responseURL, isMatch, err := sendRedirectMatchRequest(rp.redirectsAppURL, url)
+	match, isMatch, err := sendRedirectMatchRequest(rp.redirectsAppURL, url)
 	if err != nil || !isMatch {
-		rp.cache.Set(url, noMatchMarker, rp.cache.defaultTTL)
-		return "", false
+		rp.cache.Set(url, matchedRedirect{url: noMatchMarker}, rp.cache.defaultTTL)
+		return matchedRedirect{}, false
 	}
 
-	rp.cache.Set(url, responseURL, rp.cache.defaultTTL)
+	rp.cache.Set(url, match, rp.cache.defaultTTL)
 
-	return responseURL, true
+	return match, true
 }
 
-func sendRedirectMatchRequest(redirectsAppURL, url string) (string, bool, error) {
+func sendRedirectMatchRequest(redirectsAppURL, url string) (matchedRedirect, bool, error) {
 	response, err := http.Post(redirectsAppURL, "text/plain", strings.NewReader(url))
 	if err != nil {
-		return "", false, err
+		return matchedRedirect{}, false, err
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return "", false, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+		return matchedRedirect{}, false, fmt.Errorf("unexpected status code: %d", response.StatusCode)
 	}
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", false, err
+		return matchedRedirect{}, false, err
 	}
 	redirectURL := string(body)
 	if redirectURL == "@empty" {
-		return "", false, nil
+		return matchedRedirect{}, false, nil
+	}
+
+	return matchedRedirect{url: redirectURL, statusCode: parseRedirectStatus(response.Header.Get(redirectStatusHeader))}, true, nil
+}
+
+// parseRedirectStatus reads the status code sent by the redirects app, falling back to a 302 for a missing or invalid one
+func parseRedirectStatus(value string) int {
+	statusCode, err := strconv.Atoi(value)
+	if err != nil || statusCode < 300 || statusCode > 399 {
+		return http.StatusFound
 	}
 
-	return redirectURL, true, nil
+	return statusCode
 }
 
 func getFullURL(req *http.Request) string {
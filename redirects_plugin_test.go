@@ -2,14 +2,18 @@ package redirects_traefik_middleware
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	api "github.com/TRIMM/redirects-traefik-middleware/api/v1"
 	"github.com/TRIMM/redirects-traefik-middleware/internal/app"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 type TestRedirectStruct struct {
@@ -43,9 +47,11 @@ func startMockRedirectsServer(idx *app.IndexedRedirects) *httptest.Server {
 		}
 
 		request := string(requestBody)
-		redirectURL, ok := idx.Match(request)
+		redirectURL, statusCode, ok := idx.MatchRedirect(request)
 		if !ok {
 			redirectURL = "@empty"
+		} else {
+			w.Header().Set(redirectStatusHeader, strconv.Itoa(statusCode))
 		}
 		_, err = fmt.Fprintf(w, "%s", redirectURL)
 		if err != nil {
@@ -108,6 +114,52 @@ func TestServeHTTP_Match_Redirect(t *testing.T) {
 	}
 }
 
+func TestServeHTTP_RedirectStatusCode(t *testing.T) {
+	idx := app.NewIndexedRedirects()
+	idx.IndexRedirect(api.Redirect{FromURL: "^/moved$", ToURL: "/new", StatusCode: http.StatusMovedPermanently})
+	idx.IndexRule("^/temporary$", "", "/new")
+
+	mockServer := startMockRedirectsServer(idx)
+	defer mockServer.Close()
+
+	rp := getMockRedirectsPlugin(mockServer.URL)
+	testCases := []struct {
+		requestURL     string
+		expectedStatus int
+	}{
+		{"http://example.com/moved", http.StatusMovedPermanently},
+		// Served from the cache the second time
+		{"http://example.com/moved", http.StatusMovedPermanently},
+		{"http://example.com/temporary", http.StatusFound},
+	}
+
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", tc.requestURL, nil)
+		rr := httptest.NewRecorder()
+		rp.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tc.requestURL, rr.Code, tc.expectedStatus)
+		}
+	}
+}
+
+func TestParseRedirectStatus(t *testing.T) {
+	testCases := map[string]int{
+		"301": http.StatusMovedPermanently,
+		"308": http.StatusPermanentRedirect,
+		"":    http.StatusFound,
+		"200": http.StatusFound,
+		"abc": http.StatusFound,
+	}
+
+	for value, expected := range testCases {
+		if statusCode := parseRedirectStatus(value); statusCode != expected {
+			t.Errorf("parseRedirectStatus(%q) = %d, want %d", value, statusCode, expected)
+		}
+	}
+}
+
 func TestServeHTTP_NoMatch_Redirect(t *testing.T) {
 	idx := app.NewIndexedRedirects()
 	mockServer := startMockRedirectsServer(idx)
@@ -186,3 +238,182 @@ func BenchmarkMiddleware_NoMatch_Redirect(b *testing.B) {
 		}
 	}
 }
+
+func TestServeHTTP_ReportMissingPages(t *testing.T) {
+	reported := make(chan []missingPage, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "@empty")
+	})
+	mux.HandleFunc("POST "+missingPagesPath, func(w http.ResponseWriter, r *http.Request) {
+		var pages []missingPage
+		if err := json.NewDecoder(r.Body).Decode(&pages); err != nil {
+			t.Errorf("Failed to decode missing pages: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		reported <- pages
+	})
+	mockServer := httptest.NewServer(mux)
+	defer mockServer.Close()
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/missing":
+			http.NotFound(rw, req)
+		case "/gone":
+			rw.WriteHeader(http.StatusGone)
+		default:
+			rw.WriteHeader(http.StatusOK)
+		}
+	})
+	config := &Config{RedirectsAppURL: mockServer.URL, ReportMissingPages: true, ReportInterval: "50ms"}
+	rp, err := New(context.Background(), nextHandler, config, "traefik-app-test")
+	if err != nil {
+		t.Fatalf("Failed to create the plugin: %v", err)
+	}
+
+	for _, url := range []string{"http://example.com/missing", "http://example.com/missing", "http://example.com/gone", "http://example.com/found"} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Referer", "http://example.com/home")
+		rr := httptest.NewRecorder()
+		rp.ServeHTTP(rr, req)
+	}
+
+	select {
+	case pages := <-reported:
+		// Gone pages aren't reported unless ReportGone is set
+		if len(pages) != 1 || pages[0].URL != "http://example.com/missing" || pages[0].StatusCode != http.StatusNotFound ||
+			pages[0].Count != 2 || pages[0].Referrer != "http://example.com/home" {
+			t.Errorf("unexpected missing pages: %+v", pages)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing pages weren't reported")
+	}
+}
+
+func TestServeHTTP_FallbackMode(t *testing.T) {
+	idx := app.NewIndexedRedirects()
+	idx.IndexRule("^/live$", "", "/elsewhere")
+	idx.IndexRule("^/old$", "", "/new")
+	mockServer := startMockRedirectsServer(idx)
+	defer mockServer.Close()
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Upstream", "yes")
+		switch req.URL.Path {
+		case "/live":
+			_, _ = fmt.Fprint(rw, "live page")
+			return
+		case "/empty":
+			return
+		case "/file":
+			// http.ServeContent copies files through the ReadFrom of the writer
+			if readerFrom, ok := rw.(io.ReaderFrom); ok {
+				_, _ = readerFrom.ReadFrom(strings.NewReader("file content"))
+			}
+			return
+		}
+		rw.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(rw, "not found page")
+	})
+	config := &Config{RedirectsAppURL: mockServer.URL, FallbackMode: true}
+	rp, err := New(context.Background(), nextHandler, config, "traefik-app-test")
+	if err != nil {
+		t.Fatalf("Failed to create the plugin: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		requestURL       string
+		expectedStatus   int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{"Live page colliding with a redirect", "http://example.com/live", http.StatusOK, "", "live page"},
+		{"Missing page with a redirect", "http://example.com/old", http.StatusFound, "http://example.com/new", ""},
+		{"Missing page without a redirect", "http://example.com/missing", http.StatusNotFound, "", "not found page"},
+		{"Upstream response without a body", "http://example.com/empty", http.StatusOK, "", ""},
+		{"File served upstream", "http://example.com/file", http.StatusOK, "", "file content"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			rp.ServeHTTP(rr, httptest.NewRequest("GET", tc.requestURL, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if location := rr.Header().Get("Location"); location != tc.expectedLocation {
+				t.Errorf("handler returned unexpected redirect URL: got %v want %v", location, tc.expectedLocation)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if strings.Contains(rr.Body.String(), "not found page") != (tc.expectedStatus == http.StatusNotFound) {
+				t.Errorf("handler returned the body of the upstream 404: %q", rr.Body.String())
+			}
+			if upstream := rr.Header().Get("X-Upstream"); (upstream == "") != (tc.expectedStatus == http.StatusFound) {
+				t.Errorf("unexpected upstream header: %q", upstream)
+			}
+		})
+	}
+}
+
+func TestServeHTTP_ReportHits(t *testing.T) {
+	idx := app.NewIndexedRedirects()
+	idx.IndexRule("^/old$", "", "/new")
+	reported := make(chan []cachedHit, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		request, _ := io.ReadAll(r.Body)
+		redirectURL, statusCode, ok := idx.MatchRedirect(string(request))
+		if !ok {
+			redirectURL = "@empty"
+		} else {
+			w.Header().Set(redirectStatusHeader, strconv.Itoa(statusCode))
+		}
+		_, _ = fmt.Fprint(w, redirectURL)
+	})
+	mux.HandleFunc("POST "+cachedHitsPath, func(w http.ResponseWriter, r *http.Request) {
+		var hits []cachedHit
+		if err := json.NewDecoder(r.Body).Decode(&hits); err != nil {
+			t.Errorf("Failed to decode cache hits: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		reported <- hits
+	})
+	mockServer := httptest.NewServer(mux)
+	defer mockServer.Close()
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	config := &Config{RedirectsAppURL: mockServer.URL, ReportHits: true, ReportInterval: "50ms"}
+	rp, err := New(context.Background(), nextHandler, config, "traefik-app-test")
+	if err != nil {
+		t.Fatalf("Failed to create the plugin: %v", err)
+	}
+
+	// The first request asks the app, the others are answered from the cache
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		rp.ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/old", nil))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusFound)
+		}
+	}
+
+	select {
+	case hits := <-reported:
+		counts := make(map[string]int64)
+		for _, hit := range hits {
+			counts[hit.URL] = hit.Count
+		}
+		// The full URL was cached along with the redirect of the path
+		if len(counts) != 1 || counts["http://example.com/old"] != 2 {
+			t.Errorf("unexpected cache hits: %+v", hits)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache hits weren't reported")
+	}
+}